@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// inputAccumulator buffers incoming points and hands them to flush as one JSON array
+// when the flush interval elapses or maxPoints is reached, so that producers sending
+// one point per message still get aggregated.
+type inputAccumulator struct {
+	flush     func(data []byte)
+	interval  time.Duration
+	maxPoints int
+
+	mu     sync.Mutex
+	points []json.RawMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newInputAccumulator(flush func(data []byte), interval time.Duration, maxPoints int) *inputAccumulator {
+	a := &inputAccumulator{
+		flush:     flush,
+		interval:  interval,
+		maxPoints: maxPoints,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Add buffers a payload holding a single point object or an array of points
+func (a *inputAccumulator) Add(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("invalid JSON")
+	}
+
+	result := gjson.ParseBytes(data)
+	switch {
+	case result.IsObject():
+		a.mu.Lock()
+		a.points = append(a.points, json.RawMessage(result.Raw))
+	case result.IsArray():
+		a.mu.Lock()
+		result.ForEach(func(_, point gjson.Result) bool {
+			a.points = append(a.points, json.RawMessage(point.Raw))
+			return true
+		})
+	default:
+		return fmt.Errorf("expected JSON object or array")
+	}
+	full := a.maxPoints > 0 && len(a.points) >= a.maxPoints
+	a.mu.Unlock()
+
+	if full {
+		a.Flush()
+	}
+	return nil
+}
+
+// Flush hands all buffered points to flush
+func (a *inputAccumulator) Flush() {
+	a.mu.Lock()
+	points := a.points
+	a.points = nil
+	a.mu.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(points)
+	if err != nil {
+		log.Printf("Failed to encode accumulated points: %v", err)
+		return
+	}
+	a.flush(data)
+}
+
+// Close stops the flush timer and flushes whatever is still buffered
+func (a *inputAccumulator) Close() {
+	close(a.stop)
+	<-a.done
+	a.Flush()
+}
+
+func (a *inputAccumulator) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.stop:
+			return
+		}
+	}
+}
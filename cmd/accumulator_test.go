@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+func TestInputAccumulator_CompressesWithinInterval(t *testing.T) {
+	pub := newFakePublisher()
+	p := newPipeline(compressor.NewCompressor(nil), pub, "out")
+	a := newInputAccumulator(p.handle, 50*time.Millisecond, 0)
+	defer a.Close()
+
+	// One point per message, all in the same window
+	require.NoError(t, a.Add([]byte(`{"timestamp": 1000, "value": 1}`)))
+	require.NoError(t, a.Add([]byte(`{"timestamp": 1002, "value": 2}`)))
+	require.NoError(t, a.Add([]byte(`[{"timestamp": 1004, "value": 3}]`)))
+
+	select {
+	case <-pub.notify:
+	case <-time.After(time.Second):
+		t.Fatal("points were not flushed")
+	}
+
+	messages := pub.get("out")
+	require.Len(t, messages, 1)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(messages[0], &rows))
+	require.Len(t, rows, 1)
+	require.Equal(t, float64(6), rows[0]["value"])
+}
+
+func TestInputAccumulator_FlushOnMaxPoints(t *testing.T) {
+	var flushed [][]byte
+	a := newInputAccumulator(func(data []byte) { flushed = append(flushed, data) }, time.Hour, 2)
+
+	require.NoError(t, a.Add([]byte(`{"value":1}`)))
+	require.Empty(t, flushed)
+
+	require.NoError(t, a.Add([]byte(`{"value":2}`)))
+	require.Equal(t, [][]byte{[]byte(`[{"value":1},{"value":2}]`)}, flushed)
+
+	// Close flushes the remainder
+	require.NoError(t, a.Add([]byte(`{"value":3}`)))
+	a.Close()
+	require.Len(t, flushed, 2)
+	require.Equal(t, `[{"value":3}]`, string(flushed[1]))
+}
+
+func TestInputAccumulator_InvalidPayload(t *testing.T) {
+	a := newInputAccumulator(func([]byte) {}, time.Hour, 0)
+	defer a.Close()
+
+	require.Error(t, a.Add([]byte(`{"unclosed": `)))
+	require.Error(t, a.Add([]byte(`42`)))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// outputBatcher buffers compressed rows per subject and publishes them as one
+// combined JSON array when the flush interval elapses or maxRows is reached.
+type outputBatcher struct {
+	publisher publisher
+	interval  time.Duration
+	maxRows   int
+
+	mu   sync.Mutex
+	rows map[string][]json.RawMessage
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newOutputBatcher(pub publisher, interval time.Duration, maxRows int) *outputBatcher {
+	b := &outputBatcher{
+		publisher: pub,
+		interval:  interval,
+		maxRows:   maxRows,
+		rows:      make(map[string][]json.RawMessage),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Publish buffers the rows of a compressed JSON array for the subject. Any other
+// payload, e.g. ndjson or envelope output, cannot be combined and is published as
+// is, after the rows already buffered for the subject.
+func (b *outputBatcher) Publish(subject string, data []byte) error {
+	result := gjson.ParseBytes(data)
+	if !result.IsArray() {
+		if err := b.flushSubject(subject); err != nil {
+			return err
+		}
+		return b.publisher.Publish(subject, data)
+	}
+
+	b.mu.Lock()
+	result.ForEach(func(_, row gjson.Result) bool {
+		b.rows[subject] = append(b.rows[subject], json.RawMessage(row.Raw))
+		return true
+	})
+	full := b.maxRows > 0 && len(b.rows[subject]) >= b.maxRows
+	b.mu.Unlock()
+
+	if full {
+		return b.flushSubject(subject)
+	}
+	return nil
+}
+
+// Flush publishes all buffered rows
+func (b *outputBatcher) Flush() {
+	b.mu.Lock()
+	subjects := make([]string, 0, len(b.rows))
+	for subject := range b.rows {
+		subjects = append(subjects, subject)
+	}
+	b.mu.Unlock()
+
+	for _, subject := range subjects {
+		if err := b.flushSubject(subject); err != nil {
+			log.Printf("Failed to publish batched data: %v", err)
+		}
+	}
+}
+
+// Close stops the flush timer and publishes whatever is still buffered
+func (b *outputBatcher) Close() {
+	close(b.stop)
+	<-b.done
+	b.Flush()
+}
+
+func (b *outputBatcher) flushSubject(subject string) error {
+	b.mu.Lock()
+	rows := b.rows[subject]
+	delete(b.rows, subject)
+	b.mu.Unlock()
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	return b.publisher.Publish(subject, data)
+}
+
+func (b *outputBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher records published messages
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages map[string][][]byte
+	notify   chan struct{}
+}
+
+func newFakePublisher() *fakePublisher {
+	return &fakePublisher{
+		messages: make(map[string][][]byte),
+		notify:   make(chan struct{}, 16),
+	}
+}
+
+func (f *fakePublisher) Publish(subject string, data []byte) error {
+	f.mu.Lock()
+	f.messages[subject] = append(f.messages[subject], data)
+	f.mu.Unlock()
+	f.notify <- struct{}{}
+	return nil
+}
+
+func (f *fakePublisher) get(subject string) [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.messages[subject]
+}
+
+func TestOutputBatcher_CoalescesWithinInterval(t *testing.T) {
+	pub := newFakePublisher()
+	b := newOutputBatcher(pub, 50*time.Millisecond, 0)
+	defer b.Close()
+
+	require.NoError(t, b.Publish("out", []byte(`[{"ts":960,"value":1}]`)))
+	require.NoError(t, b.Publish("out", []byte(`[{"ts":1020,"value":2},{"ts":1080,"value":3}]`)))
+
+	select {
+	case <-pub.notify:
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed")
+	}
+
+	messages := pub.get("out")
+	require.Len(t, messages, 1)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(messages[0], &rows))
+	require.Len(t, rows, 3)
+}
+
+func TestOutputBatcher_FlushOnMaxRows(t *testing.T) {
+	pub := newFakePublisher()
+	b := newOutputBatcher(pub, time.Hour, 2)
+	defer b.Close()
+
+	require.NoError(t, b.Publish("out", []byte(`[{"value":1}]`)))
+	require.Empty(t, pub.get("out"))
+
+	require.NoError(t, b.Publish("out", []byte(`[{"value":2}]`)))
+	require.Len(t, pub.get("out"), 1)
+}
+
+func TestOutputBatcher_NonArrayPassesThrough(t *testing.T) {
+	pub := newFakePublisher()
+	b := newOutputBatcher(pub, time.Hour, 0)
+	defer b.Close()
+
+	require.NoError(t, b.Publish("out", []byte(`[{"value":1}]`)))
+	require.NoError(t, b.Publish("out", []byte(`{"meta": {}, "rows": []}`)))
+	require.NoError(t, b.Publish("out", []byte("{\"value\":2}\n{\"value\":3}\n")))
+
+	// Buffered rows go out first, then each payload unchanged
+	published := pub.get("out")
+	require.Len(t, published, 3)
+	require.JSONEq(t, `[{"value":1}]`, string(published[0]))
+	require.Equal(t, `{"meta": {}, "rows": []}`, string(published[1]))
+	require.Equal(t, "{\"value\":2}\n{\"value\":3}\n", string(published[2]))
+}
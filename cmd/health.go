@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// connStatus is the subset of *nats.Conn used by the health endpoints
+type connStatus interface {
+	Status() nats.Status
+}
+
+// healthHandler serves /healthz (liveness) and /readyz (readiness) based on
+// the NATS connection status and the compressor self-test result
+type healthHandler struct {
+	conn        connStatus
+	selfTestErr error
+}
+
+type healthResponse struct {
+	Status   string `json:"status"`
+	NATS     string `json:"nats"`
+	SelfTest string `json:"self_test"`
+}
+
+func newHealthServer(addr string, conn connStatus, selfTestErr error) *http.Server {
+	h := &healthHandler{conn: conn, selfTestErr: selfTestErr}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// healthz fails once the connection is lost or closed. The self-test result never
+// changes after startup, so it only affects readiness: restarting would not fix it.
+func (h *healthHandler) healthz(w http.ResponseWriter, _ *http.Request) {
+	status := h.conn.Status()
+	h.write(w, status, status != nats.DISCONNECTED && status != nats.CLOSED)
+}
+
+// readyz only succeeds while the connection is established and the self-test passed
+func (h *healthHandler) readyz(w http.ResponseWriter, _ *http.Request) {
+	status := h.conn.Status()
+	h.write(w, status, status == nats.CONNECTED && h.selfTestErr == nil)
+}
+
+func (h *healthHandler) write(w http.ResponseWriter, status nats.Status, ok bool) {
+	resp := healthResponse{Status: "ok", NATS: status.String(), SelfTest: "ok"}
+	code := http.StatusOK
+
+	if h.selfTestErr != nil {
+		resp.SelfTest = h.selfTestErr.Error()
+	}
+	if !ok {
+		resp.Status = "unhealthy"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
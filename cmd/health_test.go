@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	status nats.Status
+}
+
+func (f fakeConn) Status() nats.Status { return f.status }
+
+func checkHealth(t *testing.T, srv *http.Server, path string) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	return rec.Code
+}
+
+func TestHealth_Connected(t *testing.T) {
+	srv := newHealthServer(":0", fakeConn{status: nats.CONNECTED}, nil)
+
+	require.Equal(t, http.StatusOK, checkHealth(t, srv, "/healthz"))
+	require.Equal(t, http.StatusOK, checkHealth(t, srv, "/readyz"))
+}
+
+func TestHealth_Disconnected(t *testing.T) {
+	srv := newHealthServer(":0", fakeConn{status: nats.DISCONNECTED}, nil)
+
+	require.Equal(t, http.StatusServiceUnavailable, checkHealth(t, srv, "/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, checkHealth(t, srv, "/readyz"))
+}
+
+func TestHealth_Reconnecting(t *testing.T) {
+	srv := newHealthServer(":0", fakeConn{status: nats.RECONNECTING}, nil)
+
+	require.Equal(t, http.StatusOK, checkHealth(t, srv, "/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, checkHealth(t, srv, "/readyz"))
+}
+
+func TestHealth_SelfTestFailed(t *testing.T) {
+	srv := newHealthServer(":0", fakeConn{status: nats.CONNECTED}, errors.New("self-test: boom"))
+
+	// Restarting would not fix a failed self-test, so the process stays live
+	require.Equal(t, http.StatusOK, checkHealth(t, srv, "/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, checkHealth(t, srv, "/readyz"))
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/SergeiSkv/timeSeriesCompressor/config"
 	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
@@ -15,28 +21,42 @@ import (
 
 func main() {
 	configPath := flag.String("config", "config.yaml", "Path to config file")
+	validate := flag.Bool("validate", false, "Validate the config and run the self-test without connecting, then exit")
 	flag.Parse()
 
+	if *validate {
+		if err := validateConfig(*configPath); err != nil {
+			log.Printf("Config %s is invalid: %v", *configPath, err)
+			os.Exit(1)
+		}
+		log.Printf("Config %s is valid", *configPath)
+		return
+	}
+
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-
-	// Convert to compressor config
-	compressorConfig := &compressor.Config{
-		TimestampField:    cfg.Timestamp,
-		ValueFields:       cfg.Values,
-		GroupByFields:     cfg.GroupBy,
-		UniqueFields:      cfg.Unique,
-		AggregationMethod: cfg.Method,
-		TimeWindow:        cfg.Window,
-		Workers:           cfg.Workers,
+	// Invalid combinations such as JetStream with batched output would break the
+	// delivery guarantees, so they are refused at startup and not only by -validate
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
 	}
 
+	// Cancelled on SIGINT/SIGTERM or once NATS gives up reconnecting, starting the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	compressorConfig := newCompressorConfig(cfg)
 	c := compressor.NewCompressor(compressorConfig)
 
-	// Connect to NATS
-	nc, err := nats.Connect(cfg.NATS.URL)
+	selfTestErr := c.SelfTest()
+	if selfTestErr != nil {
+		log.Printf("Compressor self-test failed: %v", selfTestErr)
+	}
+
+	// Connect to NATS; losing the connection for good shuts the service down
+	nc, err := nats.Connect(cfg.NATS.URL, natsOptions(cfg.NATS, stop)...)
 	if err != nil {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
@@ -47,37 +67,215 @@ func main() {
 	log.Printf("Publishing compressed data to: %s", cfg.NATS.OutputSubject)
 	log.Printf("Config: %+v", cfg)
 
-	// Subscribe to input subject
-	sub, err := nc.QueueSubscribe(cfg.NATS.Subject, cfg.NATS.Queue, func(msg *nats.Msg) {
-		// Compress the message
-		compressed, err := c.CompressJSON(msg.Data)
+	if cfg.HealthAddr != "" {
+		healthSrv := newHealthServer(cfg.HealthAddr, nc, selfTestErr)
+		go func() {
+			if err := healthSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Health server failed: %v", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = healthSrv.Shutdown(ctx)
+		}()
+		log.Printf("Serving health checks on %s", cfg.HealthAddr)
+	}
+
+	var m *metrics
+	if cfg.MetricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		m = newMetrics(reg)
+
+		metricsSrv := newMetricsServer(cfg.MetricsAddr, reg)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Metrics server failed: %v", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = metricsSrv.Shutdown(ctx)
+		}()
+		log.Printf("Serving metrics on %s", cfg.MetricsAddr)
+	}
+
+	var out publisher = nc
+	if cfg.NATS.PublishRate > 0 {
+		limiter := newRateLimitedPublisher(nc, cfg.NATS.PublishRate, cfg.NATS.PublishBurst,
+			cfg.NATS.RateLimitPolicy, cfg.NATS.PublishBufferSize)
+		defer limiter.Close()
+		out = limiter
+		log.Printf("Limiting output to %.1f messages/s (%s)", cfg.NATS.PublishRate, cfg.NATS.RateLimitPolicy)
+	}
+
+	// Batch compressed rows by time when configured, otherwise publish per message
+	if cfg.NATS.BatchInterval > 0 {
+		batcher := newOutputBatcher(out, cfg.NATS.BatchInterval, cfg.NATS.BatchMaxRows)
+		defer batcher.Close()
+		out = batcher
+		log.Printf("Batching output every %s (max %d rows)", cfg.NATS.BatchInterval, cfg.NATS.BatchMaxRows)
+	}
+
+	p := newPipeline(c, out, cfg.NATS.OutputSubject)
+	p.ctx = ctx // Compression stops through CompressBatchContext once shutdown starts
+	p.metrics = m
+	if cfg.NATS.ErrorSubject != "" {
+		// Error events bypass batching and rate limiting
+		p.errorPublisher, p.errorSubject = nc, cfg.NATS.ErrorSubject
+		log.Printf("Publishing compression errors to: %s", cfg.NATS.ErrorSubject)
+	}
+	if cfg.NATS.DeadLetterSubject != "" {
+		p.deadLetterPublisher, p.deadLetterSubject = nc, cfg.NATS.DeadLetterSubject
+		log.Printf("Dead-lettering failed messages to: %s", cfg.NATS.DeadLetterSubject)
+	}
+
+	if cfg.SocketPath != "" {
+		socketSrv, err := newSocketServer(cfg.SocketPath, p)
 		if err != nil {
-			log.Printf("Failed to compress message: %v", err)
-			return
+			nc.Close()
+			log.Fatalf("Failed to listen on socket %s: %v", cfg.SocketPath, err)
 		}
+		defer socketSrv.Close()
+		log.Printf("Listening for payloads on socket %s", cfg.SocketPath)
+	}
 
-		// Calculate compression ratio
-		ratio := c.GetCompressionRatio(msg.Data, compressed)
-		log.Printf("Compressed %d bytes to %d bytes (%.2f%% reduction)", 
-			len(msg.Data), len(compressed), ratio*100)
+	if cfg.Redis.Addr != "" {
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
+		defer rdb.Close()
 
-		// Publish compressed data
-		if err := nc.Publish(cfg.NATS.OutputSubject, compressed); err != nil {
-			log.Printf("Failed to publish compressed data: %v", err)
-		}
-	})
-	if err != nil {
-		nc.Close()
-		log.Fatalf("Failed to subscribe: %v", err)
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := newRedisTransport(rdb, cfg.Redis, compressorConfig).run(ctx); err != nil {
+				log.Printf("Redis transport failed: %v", err)
+			}
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+		log.Printf("Reading Redis stream %s on %s", cfg.Redis.InputStream, cfg.Redis.Addr)
 	}
-	defer sub.Unsubscribe()
 
-	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Subscribe to input subject
+	if cfg.NATS.UseJetStream {
+		// The subscription is left to nc.Close: unsubscribing would delete the durable
+		// consumer and with it the messages pending while the service is down
+		handler := nats.MsgHandler(p.handleJetStreamMsg)
+		if m != nil {
+			handler = m.countReceived(handler)
+		}
+		if _, err := subscribeJetStream(nc, cfg.NATS, handler); err != nil {
+			nc.Close()
+			log.Fatalf("Failed to subscribe through JetStream: %v", err)
+		}
+		log.Printf("Consuming through JetStream durable consumer: %s", cfg.NATS.Durable)
+	} else {
+		handler := p.handleMsg
+		if cfg.NATS.FlushInterval > 0 {
+			// Points buffered when the service shuts down are still compressed on Close
+			flushing := *p
+			flushing.ctx = context.Background()
+			acc := newInputAccumulator(flushing.handle, cfg.NATS.FlushInterval, cfg.NATS.MaxBufferedPoints)
+			defer acc.Close()
+			handler = func(msg *nats.Msg) {
+				if err := acc.Add(msg.Data); err != nil {
+					log.Printf("Failed to buffer message: %v", err)
+				}
+			}
+			log.Printf("Accumulating input every %s (max %d points)", cfg.NATS.FlushInterval, cfg.NATS.MaxBufferedPoints)
+		}
+		if m != nil {
+			handler = m.countReceived(handler)
+		}
+
+		sub, err := nc.QueueSubscribe(cfg.NATS.Subject, cfg.NATS.Queue, handler)
+		if err != nil {
+			nc.Close()
+			log.Fatalf("Failed to subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+	}
 
 	log.Printf("TimeSeriesCompressor is running. Press Ctrl+C to exit.")
-	<-sigChan
+	<-ctx.Done()
 
 	log.Println("Shutting down...")
-}
\ No newline at end of file
+}
+
+// newCompressorConfig converts the service config to a compressor config
+func newCompressorConfig(cfg *config.Config) *compressor.Config {
+	return &compressor.Config{
+		TimestampField:    cfg.Timestamp,
+		TimestampFormat:   cfg.TimestampFormat,
+		TimestampUnit:     cfg.TimestampUnit,
+		ValueFields:       cfg.Values,
+		GroupByFields:     cfg.GroupBy,
+		UniqueFields:      cfg.Unique,
+		AggregationMethod: cfg.Method,
+		FieldMethods:      cfg.FieldMethods,
+		FieldScales:       cfg.FieldScales,
+		FieldWindows:      cfg.FieldWindows,
+		TimeWindow:        cfg.Window,
+		Workers:           cfg.Workers,
+	}
+}
+
+// natsOptions returns the reconnection options of the NATS connection; closed is
+// called once the connection is closed and will not reconnect
+func natsOptions(cfg config.NATSConfig, closed func()) []nats.Option {
+	return []nats.Option{
+		nats.MaxReconnects(cfg.MaxReconnects),
+		nats.ReconnectWait(cfg.ReconnectWait),
+		nats.RetryOnFailedConnect(cfg.RetryOnFailedConnect),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Disconnected from NATS: %v", err)
+			} else {
+				log.Printf("Disconnected from NATS")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", nc.ConnectedUrl())
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			log.Printf("NATS connection closed")
+			closed()
+		}),
+	}
+}
+
+// validateConfig loads and validates the config at path and self-tests the
+// compressor built from it, without connecting to NATS or Redis
+func validateConfig(path string) error {
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	return compressor.NewCompressor(newCompressorConfig(cfg)).SelfTest()
+}
+
+// subscribeJetStream subscribes cb to the input subject through the configured durable
+// consumer, leaving every message to be acked explicitly
+func subscribeJetStream(nc *nats.Conn, cfg config.NATSConfig, cb nats.MsgHandler) (*nats.Subscription, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return js.QueueSubscribe(cfg.Subject, cfg.Queue, cb, jetStreamSubOpts(cfg)...)
+}
+
+// jetStreamSubOpts returns the consumer options of the JetStream subscription
+func jetStreamSubOpts(cfg config.NATSConfig) []nats.SubOpt {
+	opts := []nats.SubOpt{nats.Durable(cfg.Durable), nats.AckExplicit(), nats.ManualAck()}
+	if cfg.StreamName != "" {
+		opts = append(opts, nats.BindStream(cfg.StreamName))
+	}
+	return opts
+}
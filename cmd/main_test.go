@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/config"
+)
+
+// runValidate runs the binary with -validate against a config holding content and
+// returns its exit code
+func runValidate(t *testing.T, content string) int {
+	t.Helper()
+	code, _ := runMain(t, content, true)
+	return code
+}
+
+// runMain runs main on a config with the given content in a subprocess, with or
+// without -validate, and returns its exit code and output
+func runMain(t *testing.T, content string, validate bool) (int, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestValidateMain$")
+	cmd.Env = append(os.Environ(), "COMPRESSOR_VALIDATE_CONFIG="+path, "COMPRESSOR_VALIDATE_FLAG="+strconv.FormatBool(validate))
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if err != nil {
+		require.ErrorAs(t, err, &exitErr)
+		return exitErr.ExitCode(), string(output)
+	}
+	return 0, string(output)
+}
+
+// TestValidateMain runs main in the subprocess started by runMain
+func TestValidateMain(t *testing.T) {
+	path := os.Getenv("COMPRESSOR_VALIDATE_CONFIG")
+	if path == "" {
+		t.Skip("only runs as a subprocess")
+	}
+
+	os.Args = []string{"compressor", "-config", path}
+	if os.Getenv("COMPRESSOR_VALIDATE_FLAG") == "true" {
+		os.Args = append(os.Args, "-validate")
+	}
+	main()
+}
+
+func TestValidateFlag(t *testing.T) {
+	require.Equal(t, 0, runValidate(t, "method: avg\nwindow: 30s\n"))
+	require.Equal(t, 0, runValidate(t, "values: [cpu, mem]\nfield_windows: {cpu: 1m}\n"))
+	require.NotEqual(t, 0, runValidate(t, "method: median-ish\nwindow: -1s\n"))
+	require.NotEqual(t, 0, runValidate(t, "method: [unclosed\n"))
+}
+
+func TestMain_RejectsInvalidConfig(t *testing.T) {
+	// Refused before connecting to NATS, without -validate
+	code, output := runMain(t, "nats:\n  use_jetstream: true\n  durable: compressor\n  batch_interval: 1s\n", false)
+	require.NotEqual(t, 0, code)
+	require.Contains(t, output, "Invalid config: nats use_jetstream does not support batch_interval")
+}
+
+func TestValidateConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("method: p150\nnats:\n  rate_limit_policy: drop\n"), 0o600))
+
+	err := validateConfig(path)
+	require.ErrorContains(t, err, `unknown method "p150"`)
+	require.ErrorContains(t, err, `unknown nats rate_limit_policy "drop"`)
+
+	require.NoError(t, os.WriteFile(path, []byte("nats:\n  use_jetstream: true\n  batch_interval: 1s\n"), 0o600))
+	err = validateConfig(path)
+	require.ErrorContains(t, err, "nats use_jetstream requires a durable consumer name")
+	require.ErrorContains(t, err, "nats use_jetstream does not support batch_interval")
+
+	require.NoError(t, os.WriteFile(path, []byte("nats:\n  use_jetstream: true\n  durable: compressor\n  flush_interval: 1s\n"), 0o600))
+	require.ErrorContains(t, validateConfig(path), "nats use_jetstream does not support flush_interval")
+
+	require.NoError(t, os.WriteFile(path, []byte("nats:\n  use_jetstream: true\n  durable: compressor\n"), 0o600))
+	require.NoError(t, validateConfig(path))
+
+	require.Error(t, validateConfig(filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestNewCompressorConfig_PerFieldMaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+method: sum
+values: [cpu, mem, kb, disk]
+field_methods: {cpu: avg, mem: max, disk: }
+field_scales: {kb: 1024, disk: 0}
+field_windows: {mem: 5m}
+`), 0o600))
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	c := newCompressorConfig(cfg)
+	require.Equal(t, map[string]string{"cpu": "avg", "mem": "max", "disk": "sum"}, c.FieldMethods)
+	require.Equal(t, map[string]float64{"kb": 1024, "disk": 1}, c.FieldScales)
+	require.Equal(t, map[string]time.Duration{"mem": 5 * time.Minute}, c.FieldWindows)
+	require.Equal(t, "sum", c.AggregationMethod)
+	require.Equal(t, time.Minute, c.TimeWindow)
+
+	cfg.FieldMethods["cpu"] = "mode"
+	require.ErrorContains(t, cfg.Validate(), `unknown method "mode" for field "cpu"`)
+}
+
+func TestLoadConfig_MaxReconnects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("nats:\n  max_reconnects: 0\n"), 0o600))
+
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, 0, cfg.NATS.MaxReconnects)
+
+	require.NoError(t, os.WriteFile(path, []byte("nats:\n  url: nats://example:4222\n"), 0o600))
+	cfg, err = config.LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 60, cfg.NATS.MaxReconnects)
+}
+
+func TestNATSOptions(t *testing.T) {
+	closed := 0
+	opts := nats.GetDefaultOptions()
+	for _, option := range natsOptions(config.NATSConfig{
+		MaxReconnects:        -1,
+		ReconnectWait:        5 * time.Second,
+		RetryOnFailedConnect: true,
+	}, func() { closed++ }) {
+		require.NoError(t, option(&opts))
+	}
+
+	require.Equal(t, -1, opts.MaxReconnect)
+	require.Equal(t, 5*time.Second, opts.ReconnectWait)
+	require.True(t, opts.RetryOnFailedConnect)
+	require.NotNil(t, opts.DisconnectedErrCB)
+	require.NotNil(t, opts.ReconnectedCB)
+
+	opts.ClosedCB(nil)
+	require.Equal(t, 1, closed)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the Prometheus metrics of the service
+type metrics struct {
+	received   prometheus.Counter
+	compressed prometheus.Counter
+	failures   prometheus.Counter
+	bytesIn    prometheus.Counter
+	bytesOut   prometheus.Counter
+	ratio      prometheus.Histogram
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		received: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compressor_messages_received_total",
+			Help: "Messages received on the input subject.",
+		}),
+		compressed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compressor_messages_compressed_total",
+			Help: "Payloads compressed successfully.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compressor_compression_failures_total",
+			Help: "Payloads that failed to compress.",
+		}),
+		bytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compressor_bytes_in_total",
+			Help: "Bytes of payloads compressed.",
+		}),
+		bytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "compressor_bytes_out_total",
+			Help: "Bytes of compressed output.",
+		}),
+		ratio: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "compressor_compression_ratio",
+			Help:    "Size reduction of compressed payloads, clamped to 0-1.",
+			Buckets: prometheus.LinearBuckets(0, 0.1, 11),
+		}),
+	}
+	reg.MustRegister(m.received, m.compressed, m.failures, m.bytesIn, m.bytesOut, m.ratio)
+	return m
+}
+
+// countReceived wraps a subscription callback to count the messages it receives
+func (m *metrics) countReceived(next nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		m.received.Inc()
+		next(msg)
+	}
+}
+
+// observe records the outcome of compressing a payload
+func (m *metrics) observe(input, output []byte, ratio float64, err error) {
+	if err != nil {
+		m.failures.Inc()
+		return
+	}
+	m.compressed.Inc()
+	m.bytesIn.Add(float64(len(input)))
+	m.bytesOut.Add(float64(len(output)))
+	m.ratio.Observe(ratio)
+}
+
+func newMetricsServer(addr string, gatherer prometheus.Gatherer) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
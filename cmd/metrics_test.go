@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+func TestMetrics_SubscriptionCallback(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newMetrics(reg)
+
+	out := newFakePublisher()
+	p := newPipeline(compressor.NewCompressor(nil), out, "out")
+	p.metrics = m
+	handler := m.countReceived(p.handleMsg)
+
+	valid := []byte(`[{"timestamp": 1000, "value": 1}, {"timestamp": 1001, "value": 2}]`)
+	handler(&nats.Msg{Data: valid})
+	handler(&nats.Msg{Data: []byte(`{"not": "an array"}`)})
+
+	compressed := out.get("out")
+	require.Len(t, compressed, 1)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.received))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.compressed))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.failures))
+	require.Equal(t, float64(len(valid)), testutil.ToFloat64(m.bytesIn))
+	require.Equal(t, float64(len(compressed[0])), testutil.ToFloat64(m.bytesOut))
+	require.Equal(t, 1, testutil.CollectAndCount(m.ratio))
+
+	// Payloads skipped during shutdown are received but not failures
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.ctx = ctx
+	handler(&nats.Msg{Data: valid})
+	require.Equal(t, float64(3), testutil.ToFloat64(m.received))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.failures))
+
+	// The metrics server exposes the registry
+	rec := httptest.NewRecorder()
+	newMetricsServer(":0", reg).Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "compressor_messages_received_total 3")
+	require.Contains(t, rec.Body.String(), "compressor_compression_ratio_count 1")
+}
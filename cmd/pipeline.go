@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+// publisher is the subset of *nats.Conn used to emit results
+type publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// msgPublisher is the subset of *nats.Conn used to publish messages with headers
+type msgPublisher interface {
+	PublishMsg(msg *nats.Msg) error
+}
+
+// pipeline compresses incoming payloads and publishes the result to the output subject
+type pipeline struct {
+	compressor    *compressor.Compressor
+	publisher     publisher
+	outputSubject string
+
+	// Payloads arriving after ctx is cancelled, i.e. during shutdown, are not compressed
+	ctx context.Context
+
+	// Compression failures are published as errorEvents to errorSubject when set
+	errorPublisher publisher
+	errorSubject   string
+
+	// NATS messages that fail to compress are republished unchanged to
+	// deadLetterSubject when set, with the error in the Compression-Error header
+	deadLetterPublisher msgPublisher
+	deadLetterSubject   string
+
+	metrics *metrics // Compression outcomes are recorded when set
+}
+
+// errShuttingDown is returned by process for payloads arriving during shutdown
+var errShuttingDown = errors.New("shutting down")
+
+// errorEvent describes a payload that failed to compress
+type errorEvent struct {
+	PayloadHash string `json:"payload_hash"` // Hex SHA-256 of the payload
+	Error       string `json:"error"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+func newPipeline(c *compressor.Compressor, pub publisher, outputSubject string) *pipeline {
+	return &pipeline{
+		compressor:    c,
+		publisher:     pub,
+		outputSubject: outputSubject,
+		ctx:           context.Background(),
+	}
+}
+
+// handle compresses a single payload and publishes it
+func (p *pipeline) handle(data []byte) {
+	p.handleMsg(&nats.Msg{Data: data})
+}
+
+// handleMsg is the input subscription callback: it compresses the message payload and
+// publishes it, or dead-letters the message when compression fails
+func (p *pipeline) handleMsg(msg *nats.Msg) {
+	compressed, err := p.process(msg.Data)
+	if errors.Is(err, errShuttingDown) {
+		return
+	}
+	if err != nil {
+		p.deadLetter(msg, err)
+		return
+	}
+
+	// Publish compressed data
+	if err := p.publisher.Publish(p.outputSubject, compressed); err != nil {
+		log.Printf("Failed to publish compressed data: %v", err)
+	}
+}
+
+// acker is the subset of a JetStream *nats.Msg used to settle it
+type acker interface {
+	Ack(opts ...nats.AckOpt) error
+	Nak(opts ...nats.AckOpt) error
+	Term(opts ...nats.AckOpt) error
+}
+
+// handleJetStreamMsg is the JetStream subscription callback
+func (p *pipeline) handleJetStreamMsg(msg *nats.Msg) {
+	p.handleAcked(msg, msg)
+}
+
+// handleAcked compresses and publishes msg like handleMsg, acking it only once the
+// output is published. Messages that cannot be compressed are dead-lettered and
+// terminated; those interrupted by shutdown or failing to publish are redelivered.
+func (p *pipeline) handleAcked(msg *nats.Msg, ack acker) {
+	compressed, err := p.process(msg.Data)
+	switch {
+	case errors.Is(err, errShuttingDown):
+		err = ack.Nak()
+	case err != nil:
+		p.deadLetter(msg, err)
+		err = ack.Term()
+	default:
+		if err = p.publisher.Publish(p.outputSubject, compressed); err != nil {
+			log.Printf("Failed to publish compressed data: %v", err)
+			err = ack.Nak()
+		} else {
+			err = ack.Ack()
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to acknowledge message: %v", err)
+	}
+}
+
+// process compresses a single payload and logs the achieved ratio. It goes through
+// CompressBatchContext with ctx, so once ctx is cancelled payloads not yet started
+// are skipped with errShuttingDown, which is not a compression failure: it is neither
+// reported nor counted. A payload already being compressed is still returned.
+func (p *pipeline) process(data []byte) ([]byte, error) {
+	results, err := p.compressor.CompressBatchContext(p.ctx, [][]byte{data})
+	compressed := results[0]
+	switch {
+	case compressed != nil:
+		err = nil // Compressed before ctx was cancelled
+	case p.ctx.Err() != nil:
+		return nil, errShuttingDown
+	}
+	if err != nil {
+		log.Printf("Failed to compress message: %v", err)
+		if p.metrics != nil {
+			p.metrics.observe(data, nil, 0, err)
+		}
+		p.reportError(data, err)
+		return nil, err
+	}
+
+	// Expanding payloads log 0% rather than a negative reduction
+	ratio := p.compressor.GetClampedCompressionRatio(data, compressed)
+	if p.metrics != nil {
+		p.metrics.observe(data, compressed, ratio, nil)
+	}
+	log.Printf("Compressed %d bytes to %d bytes (%.2f%% reduction, clamped to 0-100%%)",
+		len(data), len(compressed), ratio*100)
+
+	return compressed, nil
+}
+
+// reportError publishes an errorEvent for a payload when an error subject is configured
+func (p *pipeline) reportError(data []byte, cause error) {
+	if p.errorSubject == "" || p.errorPublisher == nil {
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	event, err := json.Marshal(errorEvent{
+		PayloadHash: hex.EncodeToString(hash[:]),
+		Error:       cause.Error(),
+		Timestamp:   time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	if err := p.errorPublisher.Publish(p.errorSubject, event); err != nil {
+		log.Printf("Failed to publish error event: %v", err)
+	}
+}
+
+// deadLetter republishes a message that failed to compress to the dead-letter subject
+// when one is configured
+func (p *pipeline) deadLetter(msg *nats.Msg, cause error) {
+	if p.deadLetterSubject == "" || p.deadLetterPublisher == nil {
+		return
+	}
+
+	dead := nats.NewMsg(p.deadLetterSubject)
+	dead.Data = msg.Data
+	dead.Header.Set("Compression-Error", cause.Error())
+	if msg.Subject != "" {
+		dead.Header.Set("Original-Subject", msg.Subject)
+	}
+
+	if err := p.deadLetterPublisher.PublishMsg(dead); err != nil {
+		log.Printf("Failed to publish dead letter: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+func TestPipeline_PublishesErrorEvent(t *testing.T) {
+	out, errs := newFakePublisher(), newFakePublisher()
+
+	p := newPipeline(compressor.NewCompressor(nil), out, "out")
+	p.errorPublisher, p.errorSubject = errs, "errors"
+
+	payload := []byte(`{"not": "an array"}`)
+	p.handle(payload)
+
+	require.Empty(t, out.get("out"))
+
+	events := errs.get("errors")
+	require.Len(t, events, 1)
+
+	var event errorEvent
+	require.NoError(t, json.Unmarshal(events[0], &event))
+
+	hash := sha256.Sum256(payload)
+	require.Equal(t, hex.EncodeToString(hash[:]), event.PayloadHash)
+	require.Contains(t, event.Error, "expected JSON array")
+	require.InDelta(t, time.Now().Unix(), event.Timestamp, 5)
+
+	// Successful payloads publish no error event
+	p.handle([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.Len(t, out.get("out"), 1)
+	require.Len(t, errs.get("errors"), 1)
+}
+
+func TestPipeline_LogsClampedRatio(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	p := newPipeline(compressor.NewCompressor(&compressor.Config{
+		TimestampField:    "t",
+		ValueFields:       []string{"v"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		EmitRate:          true,
+	}), newFakePublisher(), "out")
+
+	// A single short record grows once the rate fields are added
+	payload := []byte(`[{"t":1,"v":1}]`)
+	compressed, err := p.process(payload)
+	require.NoError(t, err)
+	require.Greater(t, len(compressed), len(payload))
+
+	require.Contains(t, buf.String(), fmt.Sprintf("Compressed %d bytes to %d bytes (0.00%% reduction", len(payload), len(compressed)))
+	require.NotContains(t, buf.String(), "(-")
+}
+
+func TestPipeline_SkipsPayloadsAfterShutdown(t *testing.T) {
+	out, errs, dead := newFakePublisher(), newFakePublisher(), &fakeMsgPublisher{}
+
+	p := newPipeline(compressor.NewCompressor(nil), out, "out")
+	p.errorPublisher, p.errorSubject = errs, "errors"
+	p.deadLetterPublisher, p.deadLetterSubject = dead, "dead"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.ctx = ctx
+
+	p.handle([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.Len(t, out.get("out"), 1)
+
+	cancel()
+	p.handle([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.Len(t, out.get("out"), 1)
+
+	// Skipping is not a compression failure
+	require.Empty(t, errs.get("errors"))
+	require.Empty(t, dead.messages)
+
+	_, err := p.process([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.ErrorIs(t, err, errShuttingDown)
+}
+
+// fakeMsgPublisher records messages published with headers, optionally failing
+type fakeMsgPublisher struct {
+	messages []*nats.Msg
+	err      error
+}
+
+func (f *fakeMsgPublisher) PublishMsg(msg *nats.Msg) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestPipeline_DeadLettersFailedMessages(t *testing.T) {
+	out, dead := newFakePublisher(), &fakeMsgPublisher{}
+
+	p := newPipeline(compressor.NewCompressor(nil), out, "out")
+	p.deadLetterPublisher, p.deadLetterSubject = dead, "dead"
+
+	payload := []byte(`{"not": "an array"}`)
+	p.handleMsg(&nats.Msg{Subject: "in", Data: payload})
+
+	require.Empty(t, out.get("out"))
+	require.Len(t, dead.messages, 1)
+	require.Equal(t, "dead", dead.messages[0].Subject)
+	require.Equal(t, payload, dead.messages[0].Data)
+	require.Contains(t, dead.messages[0].Header.Get("Compression-Error"), "expected JSON array")
+	require.Equal(t, "in", dead.messages[0].Header.Get("Original-Subject"))
+
+	// Successful messages are not dead-lettered
+	p.handleMsg(&nats.Msg{Subject: "in", Data: []byte(`[{"timestamp": 1000, "value": 1}]`)})
+	require.Len(t, out.get("out"), 1)
+	require.Len(t, dead.messages, 1)
+
+	// A failed dead-letter publish is logged
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	dead.err = fmt.Errorf("connection closed")
+	p.handleMsg(&nats.Msg{Subject: "in", Data: payload})
+	require.Contains(t, buf.String(), "Failed to publish dead letter: connection closed")
+
+	// Without a dead-letter subject nothing is republished
+	dead.err = nil
+	p.deadLetterSubject = ""
+	p.handleMsg(&nats.Msg{Subject: "in", Data: payload})
+	require.Len(t, dead.messages, 1)
+}
+
+// fakeAcker records how a JetStream message was settled
+type fakeAcker struct {
+	settled []string
+}
+
+func (f *fakeAcker) Ack(...nats.AckOpt) error {
+	f.settled = append(f.settled, "ack")
+	return nil
+}
+
+func (f *fakeAcker) Nak(...nats.AckOpt) error {
+	f.settled = append(f.settled, "nak")
+	return nil
+}
+
+func (f *fakeAcker) Term(...nats.AckOpt) error {
+	f.settled = append(f.settled, "term")
+	return nil
+}
+
+// failingPublisher fails every publish
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(string, []byte) error {
+	return fmt.Errorf("connection closed")
+}
+
+func TestPipeline_AcksAfterPublish(t *testing.T) {
+	out, dead, ack := newFakePublisher(), &fakeMsgPublisher{}, &fakeAcker{}
+
+	p := newPipeline(compressor.NewCompressor(nil), out, "out")
+	p.deadLetterPublisher, p.deadLetterSubject = dead, "dead"
+
+	valid := &nats.Msg{Subject: "in", Data: []byte(`[{"timestamp": 1000, "value": 1}]`)}
+	p.handleAcked(valid, ack)
+	require.Len(t, out.get("out"), 1)
+	require.Equal(t, []string{"ack"}, ack.settled)
+
+	// Payloads that can never compress are dead-lettered and not redelivered
+	p.handleAcked(&nats.Msg{Subject: "in", Data: []byte(`{}`)}, ack)
+	require.Len(t, dead.messages, 1)
+	require.Equal(t, []string{"ack", "term"}, ack.settled)
+
+	// A failed publish leaves the message for redelivery
+	p.publisher = failingPublisher{}
+	p.handleAcked(valid, ack)
+	require.Equal(t, []string{"ack", "term", "nak"}, ack.settled)
+
+	// So does a shutdown interrupting compression
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.ctx = ctx
+	p.publisher = out
+	p.handleAcked(valid, ack)
+	require.Len(t, out.get("out"), 1)
+	require.Len(t, dead.messages, 1)
+	require.Equal(t, []string{"ack", "term", "nak", "nak"}, ack.settled)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Rate limit policies applied when no publish token is available
+const (
+	rateLimitBlock  = "block"  // Publish waits for a token
+	rateLimitBuffer = "buffer" // Publish queues the message, failing once the queue is full
+)
+
+// errPublishBufferFull is returned by Publish when the buffer policy queue is full
+var errPublishBufferFull = errors.New("publish buffer full")
+
+// tokenBucket refills rate tokens per second up to burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	burst = max(burst, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type pendingMessage struct {
+	subject string
+	data    []byte
+}
+
+// rateLimitedPublisher limits publishes to the wrapped publisher with a token bucket.
+// With the block policy Publish waits for a token; with the buffer policy messages
+// are queued (up to bufferSize) and published in the background.
+type rateLimitedPublisher struct {
+	publisher publisher
+	bucket    *tokenBucket
+	policy    string
+
+	queue chan pendingMessage
+	done  chan struct{}
+}
+
+func newRateLimitedPublisher(pub publisher, rate float64, burst int, policy string, bufferSize int) *rateLimitedPublisher {
+	p := &rateLimitedPublisher{
+		publisher: pub,
+		bucket:    newTokenBucket(rate, burst),
+		policy:    policy,
+	}
+
+	if policy == rateLimitBuffer {
+		p.queue = make(chan pendingMessage, max(bufferSize, 1))
+		p.done = make(chan struct{})
+		go p.run()
+	}
+	return p
+}
+
+// Publish sends data once the rate limit allows it
+func (p *rateLimitedPublisher) Publish(subject string, data []byte) error {
+	if p.queue == nil {
+		time.Sleep(p.bucket.reserve())
+		return p.publisher.Publish(subject, data)
+	}
+
+	select {
+	case p.queue <- pendingMessage{subject: subject, data: data}:
+		return nil
+	default:
+		return errPublishBufferFull
+	}
+}
+
+// run publishes queued messages at the configured rate
+func (p *rateLimitedPublisher) run() {
+	defer close(p.done)
+
+	for msg := range p.queue {
+		time.Sleep(p.bucket.reserve())
+		if err := p.publisher.Publish(msg.subject, msg.data); err != nil {
+			log.Printf("Failed to publish rate-limited message: %v", err)
+		}
+	}
+}
+
+// Close publishes the queued messages and stops the background publisher.
+// Publish must not be called afterwards.
+func (p *rateLimitedPublisher) Close() {
+	if p.queue == nil {
+		return
+	}
+	close(p.queue)
+	<-p.done
+}
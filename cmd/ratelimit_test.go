@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// timedPublisher records when each message was published
+type timedPublisher struct {
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (p *timedPublisher) Publish(string, []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.times = append(p.times, time.Now())
+	return nil
+}
+
+func (p *timedPublisher) published() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]time.Time(nil), p.times...)
+}
+
+// requireUnderRate asserts that no more messages were published than the tokens
+// available over their span: the initial burst plus the refill
+func requireUnderRate(t *testing.T, times []time.Time, rate float64, burst int) {
+	t.Helper()
+
+	span := times[len(times)-1].Sub(times[0]).Seconds()
+	require.LessOrEqual(t, float64(len(times)), float64(burst)+span*rate+1)
+}
+
+func TestRateLimitedPublisher_Block(t *testing.T) {
+	pub := &timedPublisher{}
+	p := newRateLimitedPublisher(pub, 50, 5, rateLimitBlock, 0)
+	defer p.Close()
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, p.Publish("out", []byte(`[]`)))
+	}
+
+	// 5 tokens up front, the other 15 refill at 50/s
+	require.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+
+	times := pub.published()
+	require.Len(t, times, 20)
+	requireUnderRate(t, times, 50, 5)
+}
+
+func TestRateLimitedPublisher_Buffer(t *testing.T) {
+	pub := &timedPublisher{}
+	p := newRateLimitedPublisher(pub, 50, 1, rateLimitBuffer, 10)
+
+	// The burst is accepted without blocking until the buffer fills up
+	start := time.Now()
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		if err := p.Publish("out", []byte(`[]`)); err == nil {
+			accepted++
+		} else {
+			require.ErrorIs(t, err, errPublishBufferFull)
+		}
+	}
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.GreaterOrEqual(t, accepted, 10)
+	require.Less(t, accepted, 20)
+
+	p.Close()
+
+	times := pub.published()
+	require.Len(t, times, accepted)
+	requireUnderRate(t, times, 50, 1)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/config"
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+// redisTransport reads payloads from a Redis stream through a consumer group,
+// aggregates them across entries with a StreamingCompressor and appends the closed
+// windows to the output stream. Entries are acknowledged after every window they
+// contributed to has been written, i.e. after each periodic flush.
+type redisTransport struct {
+	client *redis.Client
+	cfg    config.RedisConfig
+	stream *compressor.StreamingCompressor
+
+	pending []string // IDs of entries read but not yet acknowledged
+}
+
+func newRedisTransport(client *redis.Client, cfg config.RedisConfig, compressorConfig *compressor.Config) *redisTransport {
+	return &redisTransport{
+		client: client,
+		cfg:    cfg,
+		stream: compressor.NewStreamingCompressor(compressorConfig),
+	}
+}
+
+// run consumes the input stream until ctx is cancelled, flushing buffered windows
+// every FlushInterval and once more on exit
+func (t *redisTransport) run(ctx context.Context) error {
+	err := t.client.XGroupCreateMkStream(ctx, t.cfg.InputStream, t.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+
+	lastFlush := time.Now()
+	for ctx.Err() == nil {
+		streams, err := t.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    t.cfg.Group,
+			Consumer: t.cfg.Consumer,
+			Streams:  []string{t.cfg.InputStream, ">"},
+			Count:    100,
+			Block:    min(t.cfg.FlushInterval, time.Second),
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Failed to read from Redis stream %s: %v", t.cfg.InputStream, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				t.handle(ctx, msg)
+			}
+		}
+
+		if time.Since(lastFlush) >= t.cfg.FlushInterval {
+			t.flush(ctx)
+			lastFlush = time.Now()
+		}
+	}
+
+	// Write the remaining windows with a fresh context, ctx is already done
+	t.flush(context.Background())
+	return nil
+}
+
+// handle aggregates a single stream entry and writes any windows it closed
+func (t *redisTransport) handle(ctx context.Context, msg redis.XMessage) {
+	t.pending = append(t.pending, msg.ID)
+
+	data, ok := msg.Values[t.cfg.Field].(string)
+	if !ok {
+		log.Printf("Redis entry %s has no %q field", msg.ID, t.cfg.Field)
+		return
+	}
+
+	rows, err := t.stream.Add([]byte(data))
+	if err != nil {
+		log.Printf("Failed to compress Redis entry %s: %v", msg.ID, err)
+		return
+	}
+
+	if err := t.write(ctx, rows); err != nil {
+		log.Printf("Failed to write to Redis stream %s: %v", t.cfg.OutputStream, err)
+	}
+}
+
+// flush writes all buffered windows and acknowledges the entries read so far
+func (t *redisTransport) flush(ctx context.Context) {
+	rows, err := t.stream.Flush()
+	if err != nil {
+		log.Printf("Failed to flush windows: %v", err)
+		return
+	}
+
+	if err := t.write(ctx, rows); err != nil {
+		log.Printf("Failed to write to Redis stream %s: %v", t.cfg.OutputStream, err)
+		return
+	}
+
+	if len(t.pending) == 0 {
+		return
+	}
+	if err := t.client.XAck(ctx, t.cfg.InputStream, t.cfg.Group, t.pending...).Err(); err != nil {
+		log.Printf("Failed to acknowledge Redis entries: %v", err)
+		return
+	}
+	t.pending = t.pending[:0]
+}
+
+// write appends rows to the output stream unless there are none
+func (t *redisTransport) write(ctx context.Context, rows []byte) error {
+	if string(rows) == "[]" {
+		return nil
+	}
+
+	return t.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: t.cfg.OutputStream,
+		Values: map[string]interface{}{t.cfg.Field: rows},
+	}).Err()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/config"
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+func TestRedisTransport_AggregatesAcrossEntries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	cfg := config.RedisConfig{
+		InputStream:   "in",
+		OutputStream:  "out",
+		Group:         "compressor",
+		Consumer:      "test",
+		Field:         "data",
+		FlushInterval: 100 * time.Millisecond,
+	}
+	transport := newRedisTransport(rdb, cfg, &compressor.Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	ctx := context.Background()
+	for _, payload := range []string{
+		`[{"ts": 1000, "value": 1}]`,
+		`[{"ts": 1010, "value": 2}]`,
+	} {
+		require.NoError(t, rdb.XAdd(ctx, &redis.XAddArgs{Stream: "in", Values: map[string]interface{}{"data": payload}}).Err())
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, transport.run(runCtx))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var entries []redis.XMessage
+	require.Eventually(t, func() bool {
+		entries = rdb.XRange(ctx, "out", "-", "+").Val()
+		return len(entries) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(entries[0].Values["data"].(string)), &rows))
+	require.Len(t, rows, 1)
+	require.Equal(t, float64(3), rows[0]["value"])
+
+	// Both entries are acknowledged once their window is written
+	require.Eventually(t, func() bool {
+		pending, err := rdb.XPending(ctx, "in", "compressor").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
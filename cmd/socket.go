@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+// maxSocketPayload bounds a single newline-delimited payload read from the socket
+const maxSocketPayload = 16 << 20
+
+// socketServer accepts newline-delimited JSON arrays on a Unix domain socket and
+// answers each with its compressed form on the same connection
+type socketServer struct {
+	pipeline *pipeline
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{} // Open connections, shut down by Close
+	closed bool
+}
+
+func newSocketServer(path string, p *pipeline) (*socketServer, error) {
+	// Remove a stale socket left over from a previous run
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &socketServer{pipeline: p, listener: listener, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections, ends reading on open ones and waits for them to
+// answer the payloads in flight. Clients that keep idle connections open do not block it.
+func (s *socketServer) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		closeRead(conn)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// closeRead shuts down the read side of conn, so a blocked read returns EOF while
+// responses can still be written, or closes conn when that is not supported
+func closeRead(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseRead() error }); ok && c.CloseRead() == nil {
+		return
+	}
+	conn.Close()
+}
+
+// track registers an accepted connection, reporting false once the server is closed
+func (s *socketServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *socketServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+func (s *socketServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Failed to accept socket connection: %v", err)
+			}
+			return
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *socketServer) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSocketPayload)
+	w := bufio.NewWriter(conn)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		compressed, err := s.pipeline.process(line)
+		if err != nil {
+			compressed, _ = json.Marshal(map[string]string{"error": err.Error()})
+		}
+
+		if _, err := w.Write(append(compressed, '\n')); err != nil {
+			log.Printf("Failed to write socket response: %v", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Failed to write socket response: %v", err)
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Failed to read from socket: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
+)
+
+func TestSocketServer_CompressesPayload(t *testing.T) {
+	c := compressor.NewCompressor(&compressor.Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	path := filepath.Join(t.TempDir(), "compressor.sock")
+	srv, err := newSocketServer(path, newPipeline(c, newFakePublisher(), "out"))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte(`[{"ts": 1000, "value": 1}, {"ts": 1010, "value": 2}]` + "\n"))
+	require.NoError(t, err)
+
+	line, err := reader.ReadBytes('\n')
+	require.NoError(t, err)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(line, &rows))
+	require.Len(t, rows, 1)
+	require.Equal(t, float64(3), rows[0]["value"])
+
+	// Invalid payloads are answered with an error object
+	_, err = conn.Write([]byte(`{"not": "array"}` + "\n"))
+	require.NoError(t, err)
+
+	line, err = reader.ReadBytes('\n')
+	require.NoError(t, err)
+	require.Contains(t, string(line), `"error"`)
+}
+
+func TestSocketServer_CloseWithIdleConnection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compressor.sock")
+	srv, err := newSocketServer(path, newPipeline(compressor.NewCompressor(nil), newFakePublisher(), "out"))
+	require.NoError(t, err)
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Make sure the connection was accepted before closing
+	_, err = conn.Write([]byte(`[{"timestamp": 1000, "value": 1}]` + "\n"))
+	require.NoError(t, err)
+	_, err = bufio.NewReader(conn).ReadBytes('\n')
+	require.NoError(t, err)
+
+	closed := make(chan error, 1)
+	go func() { closed <- srv.Close() }()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on an idle connection")
+	}
+}
@@ -1,21 +1,38 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/SergeiSkv/timeSeriesCompressor/pkg/compressor"
 )
 
 type Config struct {
-	Timestamp string        `yaml:"timestamp"`
-	Values    []string      `yaml:"values"`
-	GroupBy   []string      `yaml:"groupby"`
-	Unique    []string      `yaml:"unique"`
-	Method    string        `yaml:"method"`
-	Window    time.Duration `yaml:"window"`
-	Workers   int           `yaml:"workers"`
-	NATS      NATSConfig    `yaml:"nats"`
+	Timestamp       string        `yaml:"timestamp"`
+	TimestampFormat string        `yaml:"timestamp_format"` // "unix" (default), "unixms" or "rfc3339"
+	TimestampUnit   string        `yaml:"timestamp_unit"`   // "s" (default), "ms", "us" or "ns"
+	Values          []string      `yaml:"values"`
+	GroupBy         []string      `yaml:"groupby"`
+	Unique          []string      `yaml:"unique"`
+	Method          string        `yaml:"method"`
+	Window          time.Duration `yaml:"window"`
+	Workers         int           `yaml:"workers"`
+	NATS            NATSConfig    `yaml:"nats"`
+	Redis           RedisConfig   `yaml:"redis"`
+
+	// Per-field settings keyed by value field, e.g. field_methods: {cpu: avg, mem: max}.
+	// A field listed without a method uses method; one without a scale is unscaled.
+	FieldMethods map[string]string        `yaml:"field_methods"`
+	FieldScales  map[string]float64       `yaml:"field_scales"`
+	FieldWindows map[string]time.Duration `yaml:"field_windows"`
+
+	HealthAddr  string `yaml:"health_addr"`  // Address for /healthz and /readyz (empty disables)
+	MetricsAddr string `yaml:"metrics_addr"` // Address for Prometheus /metrics (empty disables)
+	SocketPath  string `yaml:"socket_path"`  // Unix socket for newline-delimited payloads (empty disables)
 }
 
 type NATSConfig struct {
@@ -23,6 +40,54 @@ type NATSConfig struct {
 	Subject       string `yaml:"subject"`
 	Queue         string `yaml:"queue"`
 	OutputSubject string `yaml:"output_subject"`
+	ErrorSubject  string `yaml:"error_subject"` // Subject for compression error events (empty disables)
+
+	// Subject that messages failing to compress are republished to unchanged, with
+	// the error in a Compression-Error header (empty disables)
+	DeadLetterSubject string `yaml:"dead_letter_subject"`
+
+	// Reconnection after the connection to the server is lost: up to MaxReconnects
+	// attempts (-1 for unlimited) ReconnectWait apart. RetryOnFailedConnect also
+	// retries the initial connect instead of failing at startup.
+	MaxReconnects        int           `yaml:"max_reconnects"`
+	ReconnectWait        time.Duration `yaml:"reconnect_wait"`
+	RetryOnFailedConnect bool          `yaml:"retry_on_failed_connect"`
+
+	// JetStream consumption: when UseJetStream is set, Subject is consumed through the
+	// Durable consumer (of StreamName, or the stream holding Subject when empty) and
+	// each message is acked only once its compressed output has been published
+	UseJetStream bool   `yaml:"use_jetstream"`
+	Durable      string `yaml:"durable"`
+	StreamName   string `yaml:"stream_name"`
+
+	// Input accumulation: when FlushInterval > 0, incoming points are buffered and
+	// compressed together every FlushInterval or once MaxBufferedPoints is reached
+	FlushInterval     time.Duration `yaml:"flush_interval"`
+	MaxBufferedPoints int           `yaml:"max_buffered_points"`
+
+	// Output batching: when BatchInterval > 0, compressed rows are buffered and
+	// published as one array every BatchInterval or once BatchMaxRows is reached
+	BatchInterval time.Duration `yaml:"batch_interval"`
+	BatchMaxRows  int           `yaml:"batch_max_rows"`
+
+	// Output rate limit: when PublishRate > 0, at most PublishRate messages per second
+	// (after an initial PublishBurst) are published. RateLimitPolicy "block" makes the
+	// handler wait; "buffer" queues up to PublishBufferSize messages and drops the rest.
+	PublishRate       float64 `yaml:"publish_rate"`
+	PublishBurst      int     `yaml:"publish_burst"`
+	RateLimitPolicy   string  `yaml:"rate_limit_policy"`
+	PublishBufferSize int     `yaml:"publish_buffer_size"`
+}
+
+// RedisConfig configures the optional Redis Streams transport
+type RedisConfig struct {
+	Addr          string        `yaml:"addr"` // Redis address (empty disables the transport)
+	InputStream   string        `yaml:"input_stream"`
+	OutputStream  string        `yaml:"output_stream"`
+	Group         string        `yaml:"group"`
+	Consumer      string        `yaml:"consumer"`
+	Field         string        `yaml:"field"`          // Entry field holding the JSON payload
+	FlushInterval time.Duration `yaml:"flush_interval"` // How often buffered windows are written
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -31,7 +96,9 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var cfg Config
+	// Defaults that are valid when set to zero are filled in before decoding, so they
+	// only apply when the key is absent
+	cfg := Config{NATS: NATSConfig{MaxReconnects: 60}}
 	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
 		return nil, err
@@ -53,6 +120,16 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Workers == 0 {
 		cfg.Workers = 4
 	}
+	for field, method := range cfg.FieldMethods {
+		if method == "" {
+			cfg.FieldMethods[field] = cfg.Method
+		}
+	}
+	for field, scale := range cfg.FieldScales {
+		if scale == 0 {
+			cfg.FieldScales[field] = 1
+		}
+	}
 	if cfg.NATS.URL == "" {
 		cfg.NATS.URL = "nats://localhost:4222"
 	}
@@ -65,6 +142,104 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.NATS.OutputSubject == "" {
 		cfg.NATS.OutputSubject = "timeseries.compressed"
 	}
+	if cfg.NATS.ReconnectWait == 0 {
+		cfg.NATS.ReconnectWait = 2 * time.Second
+	}
+	if cfg.NATS.RateLimitPolicy == "" {
+		cfg.NATS.RateLimitPolicy = "block"
+	}
+	if cfg.NATS.PublishBufferSize == 0 {
+		cfg.NATS.PublishBufferSize = 1000
+	}
+	if cfg.Redis.InputStream == "" {
+		cfg.Redis.InputStream = "timeseries.raw"
+	}
+	if cfg.Redis.OutputStream == "" {
+		cfg.Redis.OutputStream = "timeseries.compressed"
+	}
+	if cfg.Redis.Group == "" {
+		cfg.Redis.Group = "compressor"
+	}
+	if cfg.Redis.Consumer == "" {
+		cfg.Redis.Consumer, _ = os.Hostname()
+	}
+	if cfg.Redis.Field == "" {
+		cfg.Redis.Field = "data"
+	}
+	if cfg.Redis.FlushInterval == 0 {
+		cfg.Redis.FlushInterval = cfg.Window
+	}
 
 	return &cfg, nil
-}
\ No newline at end of file
+}
+
+// Validate reports every setting that is out of range or unknown
+func (c *Config) Validate() error {
+	var errs []error
+
+	if !compressor.KnownMethod(c.Method) {
+		errs = append(errs, fmt.Errorf("unknown method %q", c.Method))
+	}
+	switch c.TimestampFormat {
+	case "", "unix", "unixms", "rfc3339":
+	default:
+		errs = append(errs, fmt.Errorf("unknown timestamp_format %q", c.TimestampFormat))
+	}
+	switch c.TimestampUnit {
+	case "", "s", "ms", "us", "ns":
+	default:
+		errs = append(errs, fmt.Errorf("unknown timestamp_unit %q", c.TimestampUnit))
+	}
+	if c.Window <= 0 {
+		errs = append(errs, fmt.Errorf("window must be positive, got %s", c.Window))
+	}
+	for field, method := range c.FieldMethods {
+		if !compressor.KnownMethod(method) {
+			errs = append(errs, fmt.Errorf("unknown method %q for field %q", method, field))
+		}
+	}
+	for field, window := range c.FieldWindows {
+		if window <= 0 {
+			errs = append(errs, fmt.Errorf("window of field %q must be positive, got %s", field, window))
+		}
+	}
+	if c.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers must not be negative, got %d", c.Workers))
+	}
+	if c.NATS.MaxReconnects < -1 {
+		errs = append(errs, fmt.Errorf("nats max_reconnects must be -1 (unlimited) or more, got %d", c.NATS.MaxReconnects))
+	}
+	if c.NATS.ReconnectWait < 0 {
+		errs = append(errs, fmt.Errorf("nats reconnect_wait must not be negative, got %s", c.NATS.ReconnectWait))
+	}
+	if c.NATS.UseJetStream && c.NATS.Durable == "" {
+		errs = append(errs, errors.New("nats use_jetstream requires a durable consumer name"))
+	}
+	if c.NATS.UseJetStream && (c.NATS.BatchInterval > 0 || c.NATS.PublishRate > 0 && c.NATS.RateLimitPolicy == "buffer") {
+		// Batched or buffered output is published after the input message is acked
+		errs = append(errs, errors.New("nats use_jetstream does not support batch_interval or the buffer rate_limit_policy"))
+	}
+	if c.NATS.UseJetStream && c.NATS.FlushInterval > 0 {
+		// Accumulated points are compressed after their messages are acked
+		errs = append(errs, errors.New("nats use_jetstream does not support flush_interval"))
+	}
+	if c.NATS.FlushInterval < 0 || c.NATS.MaxBufferedPoints < 0 {
+		errs = append(errs, errors.New("nats flush_interval and max_buffered_points must not be negative"))
+	}
+	if c.NATS.BatchInterval < 0 || c.NATS.BatchMaxRows < 0 {
+		errs = append(errs, errors.New("nats batch_interval and batch_max_rows must not be negative"))
+	}
+	if c.NATS.PublishRate < 0 {
+		errs = append(errs, fmt.Errorf("nats publish_rate must not be negative, got %v", c.NATS.PublishRate))
+	}
+	switch c.NATS.RateLimitPolicy {
+	case "block", "buffer":
+	default:
+		errs = append(errs, fmt.Errorf("unknown nats rate_limit_policy %q", c.NATS.RateLimitPolicy))
+	}
+	if c.Redis.FlushInterval < 0 {
+		errs = append(errs, fmt.Errorf("redis flush_interval must not be negative, got %s", c.Redis.FlushInterval))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package compressor
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of AdaptiveConfig
+const (
+	defaultAdaptiveSmoothing = 0.3
+	defaultAdaptiveStep      = 2.0
+)
+
+// AdaptiveConfig bounds and steers the window of an AdaptiveCompressor
+type AdaptiveConfig struct {
+	MinWindow time.Duration // Narrowest window (default: the initial TimeWindow)
+	MaxWindow time.Duration // Widest window (default: the initial TimeWindow)
+
+	// The window is widened while the moving ratio is below LowRatio, trading resolution
+	// for size, and narrowed while it is above HighRatio, where aggregation loses too
+	// much detail. Ratios are GetCompressionRatio values; 0 disables either side.
+	LowRatio  float64
+	HighRatio float64
+
+	Smoothing float64 // Weight of the latest batch in the moving ratio, in (0, 1] (default 0.3)
+	Step      float64 // Factor the window is widened or narrowed by per batch (default 2)
+}
+
+// AdaptiveCompressor compresses successive batches like Compressor, adjusting
+// TimeWindow between calls from an exponential moving average of the achieved
+// compression ratio.
+type AdaptiveCompressor struct {
+	config   Config
+	adaptive AdaptiveConfig
+
+	mu    sync.Mutex
+	c     *Compressor
+	ratio float64
+	seen  bool
+}
+
+func NewAdaptiveCompressor(config *Config, adaptive AdaptiveConfig) *AdaptiveCompressor {
+	c := NewCompressor(config)
+
+	if adaptive.MinWindow <= 0 {
+		adaptive.MinWindow = c.config.TimeWindow
+	}
+	if adaptive.MaxWindow <= 0 {
+		adaptive.MaxWindow = c.config.TimeWindow
+	}
+	if adaptive.Smoothing <= 0 || adaptive.Smoothing > 1 {
+		adaptive.Smoothing = defaultAdaptiveSmoothing
+	}
+	if adaptive.Step <= 1 {
+		adaptive.Step = defaultAdaptiveStep
+	}
+
+	return &AdaptiveCompressor{config: c.config, adaptive: adaptive, c: c}
+}
+
+// CompressJSON compresses data with the current window, then adapts the window
+// used by the next call
+func (a *AdaptiveCompressor) CompressJSON(data []byte) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	compressed, err := a.c.CompressJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := a.c.GetCompressionRatio(data, compressed)
+	if a.seen {
+		a.ratio += a.adaptive.Smoothing * (ratio - a.ratio)
+	} else {
+		a.ratio, a.seen = ratio, true
+	}
+
+	window := a.config.TimeWindow
+	switch {
+	case a.adaptive.LowRatio != 0 && a.ratio < a.adaptive.LowRatio:
+		window = time.Duration(float64(window) * a.adaptive.Step)
+	case a.adaptive.HighRatio != 0 && a.ratio > a.adaptive.HighRatio:
+		window = time.Duration(float64(window) / a.adaptive.Step)
+	}
+	window = min(max(window, a.adaptive.MinWindow), a.adaptive.MaxWindow)
+
+	if window != a.config.TimeWindow {
+		a.config.TimeWindow = window
+		config := a.config
+		a.c = NewCompressor(&config)
+	}
+
+	return compressed, nil
+}
+
+// Window returns the window the next call will use
+func (a *AdaptiveCompressor) Window() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config.TimeWindow
+}
+
+// Ratio returns the moving compression ratio
+func (a *AdaptiveCompressor) Ratio() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ratio
+}
@@ -0,0 +1,72 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveCompressor(t *testing.T) {
+	a := NewAdaptiveCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	}, AdaptiveConfig{
+		MinWindow: 30 * time.Second,
+		MaxWindow: 4 * time.Minute,
+		LowRatio:  0.5,
+		HighRatio: 0.9,
+		Smoothing: 1,
+	})
+
+	// One record per host: nothing to aggregate, so the ratio stays low
+	sparse := make([]map[string]interface{}, 0, 50)
+	for i := 0; i < 50; i++ {
+		sparse = append(sparse, map[string]interface{}{"ts": 1000, "value": 1, "host": i})
+	}
+	low, err := json.Marshal(sparse)
+	require.NoError(t, err)
+
+	// Many records of one host in one window collapse into a single row
+	dense := make([]map[string]interface{}, 0, 50)
+	for i := 0; i < 50; i++ {
+		dense = append(dense, map[string]interface{}{"ts": 960 + i, "value": 1, "host": "web1"})
+	}
+	high, err := json.Marshal(dense)
+	require.NoError(t, err)
+
+	windows := make([]time.Duration, 0)
+	for i := 0; i < 4; i++ {
+		_, err := a.CompressJSON(low)
+		require.NoError(t, err)
+		require.Less(t, a.Ratio(), 0.5)
+		windows = append(windows, a.Window())
+	}
+	require.Equal(t, []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute, 4 * time.Minute}, windows)
+
+	windows = windows[:0]
+	for i := 0; i < 4; i++ {
+		_, err := a.CompressJSON(high)
+		require.NoError(t, err)
+		require.Greater(t, a.Ratio(), 0.9)
+		windows = append(windows, a.Window())
+	}
+	require.Equal(t, []time.Duration{2 * time.Minute, time.Minute, 30 * time.Second, 30 * time.Second}, windows)
+}
+
+func TestAdaptiveCompressor_Defaults(t *testing.T) {
+	a := NewAdaptiveCompressor(nil, AdaptiveConfig{LowRatio: 0.99})
+
+	_, err := a.CompressJSON([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.NoError(t, err)
+
+	// Without bounds the window stays at the initial TimeWindow
+	require.Equal(t, time.Minute, a.Window())
+
+	_, err = a.CompressJSON([]byte(`invalid`))
+	require.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package compressor
+
+import "sort"
+
+// Defaults for the "auto" aggregation heuristic
+const (
+	defaultAutoMinSamples        = 3
+	defaultAutoMonotonicFraction = 1.0
+)
+
+// autoAggregate implements the best-effort "auto" method: a window whose values,
+// in chronological order, mostly increase is treated as a counter and aggregated
+// to its per-second rate (or plain delta when all points share a timestamp);
+// anything else is treated as a gauge and averaged. A counter reset or noisy
+// gauge can be misclassified, so configure an explicit method when it matters.
+func (c *Compressor) autoAggregate(f *FieldAggregate) float64 {
+	if len(f.Times) != len(f.Values) {
+		return c.aggregate(f.Values, "avg")
+	}
+
+	order := f.chronologicalOrder()
+	if !c.looksLikeCounter(f.Values, order) {
+		return c.aggregate(f.Values, "avg")
+	}
+
+	first, last := order[0], order[len(order)-1]
+	delta := f.Values[last] - f.Values[first]
+	if span := f.Times[last] - f.Times[first]; span > 0 {
+		return delta / (float64(span) * c.unit().Seconds())
+	}
+	return delta
+}
+
+// looksLikeCounter reports whether enough steps of values taken in order are
+// non-decreasing, per AutoMinSamples and AutoMonotonicFraction
+func (c *Compressor) looksLikeCounter(values []float64, order []int) bool {
+	minSamples := c.config.AutoMinSamples
+	if minSamples <= 0 {
+		minSamples = defaultAutoMinSamples
+	}
+	fraction := c.config.AutoMonotonicFraction
+	if fraction <= 0 {
+		fraction = defaultAutoMonotonicFraction
+	}
+
+	if len(order) < max(minSamples, 2) {
+		return false
+	}
+
+	increasing := 0
+	for i := 1; i < len(order); i++ {
+		if values[order[i]] >= values[order[i-1]] {
+			increasing++
+		}
+	}
+
+	steps := len(order) - 1
+	return values[order[steps]] > values[order[0]] && float64(increasing) >= fraction*float64(steps)
+}
+
+// chronologicalOrder returns the indexes of the field's values ordered by timestamp
+func (g *FieldAggregate) chronologicalOrder() []int {
+	order := make([]int, len(g.Times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return g.Times[order[i]] < g.Times[order[j]] })
+	return order
+}
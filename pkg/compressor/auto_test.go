@@ -0,0 +1,57 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressJSON_AutoMethod(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"metric"},
+		AggregationMethod: "auto",
+		TimeWindow:        time.Minute,
+	}
+
+	input := `[
+		{"ts": 1010, "value": 130, "metric": "requests"},
+		{"ts": 1000, "value": 100, "metric": "requests"},
+		{"ts": 1005, "value": 110, "metric": "requests"},
+		{"ts": 1000, "value": 50, "metric": "cpu"},
+		{"ts": 1005, "value": 70, "metric": "cpu"},
+		{"ts": 1010, "value": 30, "metric": "cpu"},
+		{"ts": 1000, "value": 100, "metric": "bytes"},
+		{"ts": 1005, "value": 120, "metric": "bytes"},
+		{"ts": 1010, "value": 116, "metric": "bytes"},
+		{"ts": 1015, "value": 160, "metric": "bytes"}
+	]`
+
+	values := func(config *Config) map[string]float64 {
+		result, err := NewCompressor(config).CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+
+		byMetric := make(map[string]float64)
+		for _, row := range output {
+			byMetric[row["metric"].(string)] = row["value"].(float64)
+		}
+		return byMetric
+	}
+
+	// The monotonic counter becomes its rate, (130-100)/10s; the noisy series are averaged
+	require.Equal(t, map[string]float64{"requests": 3, "cpu": 50, "bytes": 124}, values(config))
+
+	// A looser monotonic fraction tolerates the single dip in bytes: (160-100)/15s
+	config.AutoMonotonicFraction = 0.6
+	require.Equal(t, map[string]float64{"requests": 3, "cpu": 50, "bytes": 4}, values(config))
+
+	// Requiring more samples than a window holds keeps the counter a gauge
+	config.AutoMinSamples = 4
+	require.Equal(t, map[string]float64{"requests": 340.0 / 3, "cpu": 50, "bytes": 4}, values(config))
+}
@@ -246,3 +246,96 @@ func generateBillingTestData(points, servers, customers int) []map[string]interf
 	}
 	return data
 }
+
+// BenchmarkCompressor_DenseWindow compresses a single window holding every point.
+// Associative methods (sum) keep a running aggregate, so the retained per-window state
+// stays constant and only per-record parsing allocates; methods that keep every value
+// (first) additionally grow with the number of points in the window.
+func BenchmarkCompressor_DenseWindow(b *testing.B) {
+	for _, method := range []string{"sum", "first"} {
+		for _, points := range []int{1000, 10000, 100000} {
+			b.Run(fmt.Sprintf("%s/%d", method, points), func(b *testing.B) {
+				c := NewCompressor(&Config{
+					TimestampField:    "ts",
+					ValueFields:       []string{"value"},
+					AggregationMethod: method,
+					TimeWindow:        24 * time.Hour,
+				})
+
+				data := make([]map[string]interface{}, 0, points)
+				for i := 0; i < points; i++ {
+					data = append(data, map[string]interface{}{"ts": 86400 + i%3600, "value": i})
+				}
+				jsonData, _ := json.Marshal(data)
+
+				b.ResetTimer()
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					_, _ = c.CompressJSON(jsonData)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCompressor_HashGroupKeys compares readable and hashed group keys on
+// 10000 series with long tag values
+func BenchmarkCompressor_HashGroupKeys(b *testing.B) {
+	data := make([]map[string]interface{}, 0, 50000)
+	for i := 0; i < 50000; i++ {
+		data = append(data, map[string]interface{}{
+			"ts":        1000 + i%60,
+			"value":     i,
+			"host":      fmt.Sprintf("host-%04d.eu-west-1.compute.internal", i%10000),
+			"service":   "checkout-api-production-canary",
+			"container": fmt.Sprintf("checkout-api-7d9f8b6c5d-%05d", i%10000),
+		})
+	}
+	jsonData, _ := json.Marshal(data)
+
+	for _, hash := range []bool{false, true} {
+		b.Run(fmt.Sprintf("hash=%t", hash), func(b *testing.B) {
+			c := NewCompressor(&Config{
+				TimestampField:    "ts",
+				ValueFields:       []string{"value"},
+				GroupByFields:     []string{"host", "service", "container"},
+				AggregationMethod: "sum",
+				TimeWindow:        60 * time.Second,
+				HashGroupKeys:     hash,
+			})
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, _ = c.CompressJSON(jsonData)
+			}
+		})
+	}
+}
+
+// BenchmarkMergeCompressed tests merging 16 shard outputs serially and with 8 workers
+func BenchmarkMergeCompressed(b *testing.B) {
+	shards := mergeTestShards(b, 16)
+
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			c := NewCompressor(&Config{
+				TimestampField:    "ts",
+				ValueFields:       []string{"value"},
+				GroupByFields:     []string{"host"},
+				AggregationMethod: "max",
+				TimeWindow:        60 * time.Second,
+				Workers:           workers,
+			})
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_, _ = c.MergeCompressed(shards)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package compressor
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// resultCache is a concurrency-safe LRU cache of compressed outputs keyed by input hash
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key   [sha256.Size]byte
+	value []byte
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element, size),
+	}
+}
+
+// get returns a copy of the cached output for key
+func (rc *resultCache) get(key [sha256.Size]byte) ([]byte, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.order.MoveToFront(elem)
+
+	value := elem.Value.(*cacheEntry).value //nolint:forcetypeassert // only *cacheEntry is stored
+	return append([]byte(nil), value...), true
+}
+
+// put stores a copy of value, evicting the least recently used entry when full
+func (rc *resultCache) put(key [sha256.Size]byte, value []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, ok := rc.entries[key]; ok {
+		rc.order.MoveToFront(elem)
+		return
+	}
+
+	rc.entries[key] = rc.order.PushFront(&cacheEntry{key: key, value: append([]byte(nil), value...)})
+
+	if rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key) //nolint:forcetypeassert // only *cacheEntry is stored
+	}
+}
+
+// CompressJSONWithFingerprint compresses data like CompressJSON and also returns a
+// fingerprint of the output: the hex SHA-256 of the rows in their deterministic
+// order, so identical input always yields the same fingerprint and consumers can
+// detect re-sent data without comparing it
+func (c *Compressor) CompressJSONWithFingerprint(data []byte) ([]byte, string, error) {
+	compressed, err := c.CompressJSON(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(compressed)
+	return compressed, hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,117 @@
+package compressor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestCompressJSON_Cache(t *testing.T) {
+	var calls atomic.Int64
+
+	c := NewCompressor(&Config{
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		CacheSize:         2,
+		TimestampFunc: func(record gjson.Result) (int64, bool) {
+			calls.Add(1)
+			return record.Get("ts").Int(), true
+		},
+	})
+
+	input := []byte(`[{"ts": 1000, "value": 1}, {"ts": 1010, "value": 2}]`)
+
+	first, err := c.CompressJSON(input)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), calls.Load())
+
+	second, err := c.CompressJSON(input)
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Equal(t, int64(2), calls.Load(), "cache hit must not recompute")
+
+	// Concurrent batches of the same payload are served from the cache
+	results := c.CompressBatch([][]byte{input, input, input, input})
+	for _, result := range results {
+		require.Equal(t, first, result)
+	}
+	require.Equal(t, int64(2), calls.Load())
+}
+
+func TestResultCache_Eviction(t *testing.T) {
+	rc := newResultCache(2)
+	a, b, cKey := sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")), sha256.Sum256([]byte("c"))
+
+	rc.put(a, []byte("A"))
+	rc.put(b, []byte("B"))
+
+	// Touch a so b becomes the least recently used entry
+	_, ok := rc.get(a)
+	require.True(t, ok)
+
+	rc.put(cKey, []byte("C"))
+
+	_, ok = rc.get(b)
+	require.False(t, ok)
+
+	value, ok := rc.get(a)
+	require.True(t, ok)
+	require.Equal(t, []byte("A"), value)
+}
+
+func TestResultCache_Concurrent(t *testing.T) {
+	rc := newResultCache(8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := sha256.Sum256([]byte{byte(i % 10)})
+			rc.put(key, []byte{byte(i)})
+			rc.get(key)
+		}(i)
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, rc.order.Len(), 8)
+}
+
+func TestCompressJSONWithFingerprint(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host", "region"}
+	c := NewCompressor(config)
+
+	input := []byte(`[
+		{"timestamp": 1000, "value": 1, "host": "web1", "region": "eu"},
+		{"timestamp": 1000, "value": 2, "host": "web2", "region": "us"},
+		{"timestamp": 1100, "value": 4, "host": "web1", "region": "eu"}
+	]`)
+
+	first, fingerprint, err := c.CompressJSONWithFingerprint(input)
+	require.NoError(t, err)
+	require.Len(t, fingerprint, 2*sha256.Size)
+
+	// Repeated calls see different map iteration orders but agree
+	for i := 0; i < 20; i++ {
+		again, repeated, err := NewCompressor(config).CompressJSONWithFingerprint(input)
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+		require.Equal(t, fingerprint, repeated)
+	}
+
+	changed := bytes.Replace(input, []byte(`"value": 4`), []byte(`"value": 5`), 1)
+	_, other, err := c.CompressJSONWithFingerprint(changed)
+	require.NoError(t, err)
+	require.NotEqual(t, fingerprint, other)
+
+	_, _, err = c.CompressJSONWithFingerprint([]byte(`{}`))
+	require.Error(t, err)
+}
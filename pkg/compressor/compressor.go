@@ -1,193 +1,1700 @@
 package compressor
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/tidwall/gjson"
 )
 
+// missingTagValue is the tag value of absent group-by fields under the "separate" policy
+const missingTagValue = "<missing>"
+
 type Compressor struct {
 	config Config
+	cache  *resultCache // nil unless Config.CacheSize > 0
+	err    error        // Invalid config, returned by every call
+}
+
+type Config struct {
+	TimestampField string   // Field with timestamp (default: "timestamp")
+	ValueFields    []string // Fields with values for aggregation (default: ["value"], may be empty for "count")
+	GroupByFields  []string // Fields for grouping (for example: ["host", "service"])
+
+	// GroupByMissingPolicy controls records missing a group-by field:
+	// "" - the field is left out of the group (records merge with others lacking it),
+	// "skip" - the record is dropped, "empty" - the tag is emitted as "",
+	// "separate" - the tag is emitted as "<missing>"
+	GroupByMissingPolicy string
+
+	// HashGroupKeys replaces each composed group key with its SHA-256 digest for map
+	// lookups, keeping memory and hashing cost flat for high-cardinality keys. Output
+	// tags are unaffected.
+	HashGroupKeys bool
+
+	// Правила агрегации
+	AggregationMethod string        // "sum", "avg", "min", "max", "count", "last", "first", "bitor", "bitand", "median", "p50"/"p95"/..., "auto", "rate"
+	TimeWindow        time.Duration // Time window for grouping (default: 1 minute)
+	WindowReference   int64         // Epoch windows are aligned to (default: 0, the Unix epoch)
+	WindowOffset      time.Duration // Shift of window boundaries from WindowReference (e.g. 9h for days starting 09:00 UTC)
+	WindowField       string        // Per-record window size in seconds overriding TimeWindow (e.g. "rollup")
+
+	// FieldMethods overrides the aggregation method of individual value fields, e.g.
+	// {"cpu": "avg", "bytes": "sum"}; unlisted fields use the group's method
+	FieldMethods map[string]string
+
+	// FieldScales multiplies every value of the listed fields before aggregation, e.g.
+	// {"kb": 1024} to aggregate kilobyte readings as bytes
+	FieldScales map[string]float64
+
+	// OutputFieldNames renames value fields on output, e.g. {"cpu": "cpu_avg"}; unlisted
+	// fields keep their name. Two fields sharing an output name fail every call, see
+	// Compressor.Err.
+	OutputFieldNames map[string]string
+
+	// Thresholds of the best-effort "auto" method: a window with at least AutoMinSamples
+	// values (default 3) of which AutoMonotonicFraction of the steps (default 1, all)
+	// are non-decreasing is aggregated as a counter rate, otherwise as a gauge average
+	AutoMinSamples        int
+	AutoMonotonicFraction float64
+
+	// FieldWindows aggregates each value field in its own window, overriding TimeWindow
+	// for the listed fields. When set, one row is emitted per (field, window), holding
+	// only that field's value and the window's timestamp.
+	FieldWindows map[string]time.Duration
+
+	// Per-group aggregation selected by a tag value, e.g. MethodTagField "metric_type" with
+	// MethodByTag {"counter": "sum", "gauge": "avg"}. The tag field should also be listed in
+	// GroupByFields so records of different types never share a group.
+	MethodTagField string
+	MethodByTag    map[string]string
+
+	UniqueFields []string // Fields that must match for aggregation (for example: ["customer_id"])
+	// If customer_id is different - do NOT aggregate, even if host is the same
+
+	// TenantField isolates tenants: its value leads every group key and is always
+	// emitted, "" when a record lacks it, so records of different tenants never share
+	// a group whatever their tags
+	TenantField string
+
+	// Geo bucketing: GeoHashFields names the latitude and longitude fields; records are
+	// grouped by the geohash of GeoHashPrecision characters (default: 5) emitted as "geohash"
+	GeoHashFields    [2]string
+	GeoHashPrecision int
+
+	// Accepted timestamp range (inclusive); records outside are skipped and counted as OutOfRange
+	MinTimestamp *int64
+	MaxTimestamp *int64
+
+	// TieBreakField orders records sharing the earliest/latest timestamp for "first"/"last"
+	// (for example a sequence number); without it ties keep input order
+	TieBreakField string
+
+	// ValueOrderField sorts each group's values by this field before aggregation, making
+	// order-sensitive methods ("first", "last") deterministic regardless of input order
+	ValueOrderField string
+
+	// SubSampleInterval expands records whose value fields hold arrays (e.g. {"t": 1000, "v": [10, 20]})
+	// into one point per element, the element at index i being timestamped t + i*SubSampleInterval
+	SubSampleInterval time.Duration
+
+	FlattenNestedArrays bool // Treat records inside nested arrays (e.g. [[{...}, {...}], {...}]) as top-level records
+
+	CollectFields []string // Fields whose distinct values within a group are emitted as an array (for example: ["pod"])
+
+	// PassthroughFields are copied to the output unaggregated (for example: ["region"]),
+	// from the first record of the group that has each; later differing values are ignored
+	PassthroughFields []string
+
+	Workers int // Number of Forkers for parallel processing
+
+	// OnComplete is called with the stats of every successful compression (not for cache hits)
+	OnComplete func(stats CompressionStats)
+
+	CacheSize int // Number of compressed outputs cached by input hash for repeated payloads (0 disables)
+
+	// TimestampFormat selects how TimestampField is read and emitted: "unix" (default)
+	// epoch timestamps in TimestampUnit, RFC 3339 strings also accepted on input;
+	// "unixms" epoch milliseconds; "rfc3339" RFC 3339 strings, emitted in UTC. Records
+	// whose timestamp does not parse are skipped.
+	TimestampFormat string
+
+	// TimestampUnit is the unit of epoch timestamps and of all window arithmetic: "s"
+	// (default), "ms", "us" or "ns". Durations such as TimeWindow are converted to it,
+	// and WindowReference, MinTimestamp, MaxTimestamp and TimestampFunc results are in it.
+	TimestampUnit string
+
+	// TimestampFunc overrides TimestampField extraction. It receives the whole record and
+	// returns the epoch timestamp in TimestampUnit; returning false skips the record.
+	TimestampFunc func(record gjson.Result) (int64, bool)
+
+	// Optional bounds applied to aggregated values; out-of-range values are clamped, not dropped
+	ClampMin *float64
+	ClampMax *float64
+
+	NonNegative bool // Clamp negative aggregates (e.g. counter rates after resets) to 0
+
+	// DefaultSampleInterval is the denominator of the "rate" method for windows whose
+	// samples share one timestamp, e.g. a single point (default 0: rate is 0)
+	DefaultSampleInterval time.Duration
+
+	EmitRate       bool // Emit "span_seconds" and "sample_rate" (records per second) for each group
+	EmitDataBounds bool // Emit "data_first"/"data_last", the observed timestamp range of each group
+	NestedOutput   bool // Emit aggregated values under "values" and tags under "tags" instead of flat keys
+	EmitEnvelope   bool // Wrap the output as {"meta": {...}, "data": [...]} with the config and Version
+
+	// EmitCount adds the number of records aggregated into each row under CountField
+	// (default "count"). CountField must not name a value field or the timestamp field;
+	// such a config fails every call, see Compressor.Err.
+	EmitCount  bool
+	CountField string
+
+	// OutputAsObject emits a JSON object mapping each row's group key to the row instead
+	// of an array. The key is the group's tags as sorted "name=value" pairs followed by
+	// "window=<start>", e.g. "host=web1;window=960", plus "size=<length>" in
+	// TimestampUnit and "field=<name>" with WindowField and FieldWindows; the
+	// CollectOverflow group is "overflow". Ignored with EmitEnvelope.
+	OutputAsObject bool
+
+	// EmitSchemaHeader emits a SchemaPayload: the output fields and their types once,
+	// then each row as an array of values in schema order, without per-row keys.
+	// DecodeSchemaRows restores the plain rows. Takes precedence over OutputAsObject and
+	// is ignored with EmitEnvelope.
+	EmitSchemaHeader bool
+
+	// RowBuilder replaces the default output row shape. It receives the group and its
+	// aggregated values keyed by output field.
+	RowBuilder func(g *Group, aggregated map[string]float64) map[string]interface{}
+
+	TimestampRound time.Duration // Round emitted timestamps to the nearest multiple (e.g. 10s); 0 disables
+
+	EmitISOTimestamp bool           // Also emit "timestamp_iso", the row timestamp as RFC 3339
+	ISOLocation      *time.Location // Time zone of "timestamp_iso" (default UTC)
+
+	SortForInsert bool // Order output rows by series (tags), then timestamp, for TSDB bulk inserts
+
+	// InputFormat is "array" (default) for a JSON array of records or "ndjson" for one
+	// JSON object per line; empty and malformed lines are skipped
+	InputFormat string
+
+	// OutputFormat is "array" (default) for a JSON array of rows or "ndjson" for one
+	// row per line. Every line, including the last, ends in a newline, so no rows
+	// produce empty output. Envelope, schema and keyed output take precedence.
+	OutputFormat string
+
+	GzipLevel int // Level of CompressJSONGzip, gzip.BestSpeed (1) to gzip.BestCompression (9); 0 is gzip.DefaultCompression
+
+	// Pipeline replaces the single aggregation with stages applied in order, e.g. a
+	// "downsample" stage feeding an "aggregate" stage for very dense input; see Stage
+	Pipeline []Stage
+
+	// EmptyInputPolicy controls the result for an empty input array:
+	// "empty" (default) - the usual empty output, "error" - ErrEmptyInput, "null" - null
+	EmptyInputPolicy string
+
+	// StalenessGap flags the first window after a gap longer than this between
+	// consecutive windows of a series with "_stale_after_gap": true
+	StalenessGap time.Duration
+
+	// WindowMergeGap combines consecutive windows of a series into the earlier one
+	// when the last record of one is at most this far from the first record of the
+	// next, e.g. to keep a burst split by clock skew at a boundary in one row. The
+	// values are re-aggregated over the merged windows; 0 disables.
+	WindowMergeGap time.Duration
+
+	// SessionEndField marks end-of-session records (e.g. "_end": true). In a
+	// StreamingCompressor such a record immediately emits all open windows of the
+	// series matching its group-by fields; the marker itself is not aggregated.
+	SessionEndField string
+
+	// MultiplicityField holds how many times a pre-aggregated record's values occurred,
+	// e.g. {"value": 5, "n": 100}: sum adds value*n, count adds n and avg divides by Σn.
+	// It applies to the running-aggregate methods (sum, avg, count; min and max are
+	// unaffected). Records without the field count once. Configs using any other method,
+	// or count-only mode, are rejected since their results would ignore it.
+	MultiplicityField string
+
+	// SpillThresholdBytes bounds the input bytes whose groups are held in memory: once
+	// exceeded, the partial groups are written to a temporary file in SpillDir (default
+	// os.TempDir) and merged back after the input is consumed. Zero disables spilling.
+	SpillThresholdBytes int
+	SpillDir            string
+
+	// ValueSubPath unwraps value fields that hold an object, e.g. "raw" for
+	// {"value": {"raw": 10}}; values that are still not numbers are skipped
+	ValueSubPath string
+
+	// SumDuplicateKeys sums all occurrences of a value field repeated within one JSON
+	// object (e.g. {"bytes": 1, "bytes": 2} yields 3) instead of reading only the first
+	SumDuplicateKeys bool
+
+	// MinUsefulRatio returns the original payload unchanged when the achieved
+	// compression ratio is below it; zero always returns the compressed output
+	MinUsefulRatio float64
+
+	MinSamples int // Omit groups with fewer records than this from the output
+
+	// DiscardFirstWindow omits the earliest window of each series (tag set) in the
+	// input, whose data is often incomplete for rate and delta metrics
+	DiscardFirstWindow bool
+
+	MaxWindows int // Fail when the input spans more distinct windows than this; 0 disables
+
+	Epsilon float64 // Tolerance when comparing aggregated values for equality; zero means exact
+
+	Debug bool // Emit "_src_start"/"_src_end", the input byte range of the records in each group
+
+	// CollectOverflow aggregates records that could not be bucketed (missing or
+	// out-of-range timestamp, missing group-by field) into a single row tagged
+	// "_overflow": true instead of dropping them. Only applies to batch compression.
+	CollectOverflow bool
+}
+
+// ErrEmptyInput is returned for an empty input array with EmptyInputPolicy "error"
+var ErrEmptyInput = errors.New("empty input array")
+
+func DefaultConfig() *Config {
+	return &Config{
+		TimestampField:    "timestamp",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		Workers:           4,
+	}
+}
+
+func NewCompressor(config *Config) *Compressor {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if config.TimestampField == "" {
+		config.TimestampField = "timestamp"
+	}
+	const defaultAggregation = "sum"
+	if config.AggregationMethod == "" {
+		config.AggregationMethod = defaultAggregation
+	}
+	// Counting records needs no value field, so "count" keeps ValueFields empty
+	if len(config.ValueFields) == 0 && config.AggregationMethod != "count" {
+		config.ValueFields = []string{"value"}
+	}
+	if config.TimeWindow == 0 {
+		config.TimeWindow = time.Minute
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.GeoHashFields[0] != "" && config.GeoHashPrecision <= 0 {
+		config.GeoHashPrecision = 5
+	}
+
+	if config.EmitCount && config.CountField == "" {
+		config.CountField = "count"
+	}
+
+	c := &Compressor{
+		config: *config,
+	}
+	if config.CacheSize > 0 {
+		c.cache = newResultCache(config.CacheSize)
+	}
+	c.err = c.checkConfig()
+
+	return c
+}
+
+// Err returns the config error found by NewCompressor, or nil; every call of a
+// Compressor with an invalid config fails with it
+func (c *Compressor) Err() error {
+	return c.err
+}
+
+// checkConfig reports settings that would produce ambiguous output
+func (c *Compressor) checkConfig() error {
+	names := make(map[string]string, len(c.valueKeys()))
+	for _, key := range c.valueKeys() {
+		name := c.outputField(key)
+		if name == c.config.TimestampField {
+			return fmt.Errorf("value field %q is output as the timestamp field %q", key, name)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("value fields %q and %q are both output as %q", other, key, name)
+		}
+		names[name] = key
+	}
+
+	if c.config.EmitCount {
+		if c.config.CountField == c.config.TimestampField {
+			return fmt.Errorf("count field %q collides with the timestamp field", c.config.CountField)
+		}
+		for _, key := range c.valueKeys() {
+			if c.outputField(key) == c.config.CountField {
+				return fmt.Errorf("count field %q collides with a value field", c.config.CountField)
+			}
+		}
+	}
+
+	if c.config.MultiplicityField != "" {
+		if len(c.config.ValueFields) == 0 {
+			return fmt.Errorf("multiplicity field %q requires value fields", c.config.MultiplicityField)
+		}
+		for _, method := range c.configuredMethods() {
+			switch method {
+			case "sum", "avg", "mean", "min", "max", "count":
+			default:
+				return fmt.Errorf("multiplicity field %q cannot weight method %q", c.config.MultiplicityField, method)
+			}
+		}
+	}
+	return nil
+}
+
+// configuredMethods returns AggregationMethod followed by the FieldMethods and
+// MethodByTag methods
+func (c *Compressor) configuredMethods() []string {
+	methods := []string{c.config.AggregationMethod}
+	for _, method := range c.config.FieldMethods {
+		methods = append(methods, method)
+	}
+	for _, method := range c.config.MethodByTag {
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+func (c *Compressor) CompressJSON(data []byte) ([]byte, error) {
+	if c.cache == nil {
+		return c.compressJSON(data)
+	}
+
+	key := sha256.Sum256(data)
+	if cached, ok := c.cache.get(key); ok {
+		return cached, nil
+	}
+
+	compressed, err := c.compressJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.put(key, compressed)
+
+	return compressed, nil
+}
+
+func (c *Compressor) compressJSON(data []byte) ([]byte, error) {
+	compressed, _, err := c.compress(data)
+	return compressed, err
+}
+
+// compress aggregates data and returns the output together with its stats
+func (c *Compressor) compress(data []byte) ([]byte, CompressionStats, error) {
+	if c.err != nil {
+		return nil, CompressionStats{}, c.err
+	}
+	if len(c.config.Pipeline) > 0 {
+		return c.compressPipeline(data)
+	}
+
+	start := time.Now()
+
+	groups, stats, err := c.collectGroupsStats(data)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.ParseDuration = time.Since(start)
+
+	if stats.Records+stats.Skipped+stats.OutOfRange == 0 {
+		switch c.config.EmptyInputPolicy {
+		case "error":
+			return nil, stats, ErrEmptyInput
+		case "null":
+			return []byte("null"), stats, nil
+		}
+	}
+
+	start = time.Now()
+	output := make([]map[string]interface{}, 0, len(groups))
+
+	var keyed map[string]map[string]interface{}
+	if c.config.OutputAsObject {
+		keyed = make(map[string]map[string]interface{}, len(groups))
+	}
+
+	stale := c.staleGroups(groups)
+	for _, group := range c.orderedGroups(groups) {
+		row := c.buildRow(group)
+		if stale[group] {
+			row["_stale_after_gap"] = true
+		}
+		output = append(output, row)
+		if keyed != nil {
+			keyed[c.outputKey(group)] = row
+		}
+	}
+	stats.AggregateDuration = time.Since(start)
+
+	start = time.Now()
+	var compressed []byte
+	switch {
+	case c.config.EmitEnvelope:
+		compressed, err = json.Marshal(c.envelope(output))
+	case c.config.EmitSchemaHeader:
+		compressed, err = json.Marshal(schemaPayload(output))
+	case keyed != nil:
+		compressed, err = json.Marshal(keyed)
+	case c.config.OutputFormat == "ndjson":
+		compressed, err = marshalNDJSON(output)
+	default:
+		compressed, err = json.Marshal(output)
+	}
+	stats.MarshalDuration = time.Since(start)
+	stats.Rows = len(output)
+
+	stats.sizes(data, compressed)
+	if err == nil && c.config.MinUsefulRatio != 0 && stats.Ratio < c.config.MinUsefulRatio {
+		compressed = data
+		stats.Passthrough = true
+		stats.sizes(data, compressed)
+	}
+
+	if err == nil && c.config.OnComplete != nil {
+		c.config.OnComplete(stats)
+	}
+
+	return compressed, stats, err
+}
+
+// marshalNDJSON marshals each row as a line of JSON terminated by a newline
+func marshalNDJSON(rows []map[string]interface{}) ([]byte, error) {
+	out := make([]byte, 0)
+	for _, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		out = append(append(out, line...), '\n')
+	}
+	return out, nil
+}
+
+// orderedGroups returns the groups in output order: by series then timestamp with
+// SortForInsert, by timestamp otherwise, with the group key breaking ties so that
+// identical input always produces identical output
+func (c *Compressor) orderedGroups(groups map[string]*Group) []*Group {
+	type entry struct {
+		key, series string
+		timestamp   int64
+		group       *Group
+	}
+
+	entries := make([]entry, 0, len(groups))
+	for key, group := range groups {
+		e := entry{key: key, timestamp: c.rowTimestamp(group), group: group}
+		if c.config.SortForInsert {
+			e.series = tagsKey(group.Tags)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.series != b.series {
+			return a.series < b.series
+		}
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		return a.key < b.key
+	})
+
+	ordered := make([]*Group, len(entries))
+	for i, e := range entries {
+		ordered[i] = e.group
+	}
+	return ordered
+}
+
+// checkWindows fails when the groups span more than MaxWindows distinct windows
+func (c *Compressor) checkWindows(groups map[string]*Group) error {
+	windows := make(map[int64]struct{})
+	for _, group := range groups {
+		if group.Overflow {
+			continue
+		}
+		windows[group.Window] = struct{}{}
+		if len(windows) > c.config.MaxWindows {
+			return fmt.Errorf("input spans more than %d windows", c.config.MaxWindows)
+		}
+	}
+	return nil
+}
+
+// windowSeries identifies the series of a group: its tags, FieldWindows field and
+// overflow flag, but not its window
+func windowSeries(group *Group) string {
+	return fmt.Sprintf("%s|%s|%t", tagsKey(group.Tags), group.Field, group.Overflow)
+}
+
+// discardFirstWindows removes the earliest window of every series from groups
+func (c *Compressor) discardFirstWindows(groups map[string]*Group) {
+	earliest := make(map[string]int64)
+	for _, group := range groups {
+		key := windowSeries(group)
+		if window, ok := earliest[key]; !ok || group.Window < window {
+			earliest[key] = group.Window
+		}
+	}
+
+	for key, group := range groups {
+		if group.Window == earliest[windowSeries(group)] {
+			delete(groups, key)
+		}
+	}
+}
+
+// mergeWindowGaps merges each window into the previous window of its series when
+// their records are at most WindowMergeGap apart
+func (c *Compressor) mergeWindowGaps(groups map[string]*Group) {
+	series := make(map[string][]string)
+	for key, group := range groups {
+		if !group.Overflow {
+			s := windowSeries(group)
+			series[s] = append(series[s], key)
+		}
+	}
+
+	maxGap := c.units(c.config.WindowMergeGap)
+	for _, keys := range series {
+		sort.Slice(keys, func(i, j int) bool {
+			if wi, wj := groups[keys[i]].Window, groups[keys[j]].Window; wi != wj {
+				return wi < wj
+			}
+			return keys[i] < keys[j]
+		})
+
+		prev := groups[keys[0]]
+		for _, key := range keys[1:] {
+			group := groups[key]
+			if group.FirstTime-prev.LastTime > maxGap {
+				prev = group
+				continue
+			}
+
+			prev.merge(group)
+			prev.WindowSize = group.Window + group.WindowSize - prev.Window
+			delete(groups, key)
+		}
+	}
+}
+
+// staleGroups returns the groups that follow a gap longer than StalenessGap since the
+// previous window of the same series
+func (c *Compressor) staleGroups(groups map[string]*Group) map[*Group]bool {
+	if c.config.StalenessGap <= 0 {
+		return nil
+	}
+
+	series := make(map[string][]*Group)
+	for _, group := range groups {
+		// The overflow group has no real window to measure a gap from
+		if group.Overflow {
+			continue
+		}
+		key := windowSeries(group)
+		series[key] = append(series[key], group)
+	}
+
+	maxGap := c.units(c.config.StalenessGap)
+	stale := make(map[*Group]bool)
+	for _, windows := range series {
+		sort.Slice(windows, func(i, j int) bool { return windows[i].Window < windows[j].Window })
+
+		for i := 1; i < len(windows); i++ {
+			prev := windows[i-1]
+			if windows[i].Window-(prev.Window+prev.WindowSize) > maxGap {
+				stale[windows[i]] = true
+			}
+		}
+	}
+	return stale
+}
+
+// collectGroups parses the input array and buckets its records into groups keyed by window and tags
+func (c *Compressor) collectGroups(data []byte) (map[string]*Group, error) {
+	groups, _, err := c.collectGroupsStats(data)
+	return groups, err
+}
+
+// collectGroupsStats is collectGroups that also counts how input records were handled
+func (c *Compressor) collectGroupsStats(data []byte) (map[string]*Group, CompressionStats, error) {
+	var stats CompressionStats
+	if c.err != nil {
+		return nil, stats, c.err
+	}
+
+	groups := make(map[string]*Group)
+
+	var (
+		spill    *groupSpill
+		spillErr error
+		held     int
+
+		windowsErr error
+		nextCheck  = c.config.MaxWindows
+	)
+	if c.config.SpillThresholdBytes > 0 {
+		spill = newGroupSpill(c.config.SpillDir)
+		defer spill.Close()
+	}
+
+	err := c.forEachRecord(data,
+		func(value gjson.Result) bool {
+			if c.config.FlattenNestedArrays && value.IsArray() {
+				// Descend one level into nested arrays of records
+				value.ForEach(func(_, nested gjson.Result) bool {
+					stats.count(c.addRecordOrOverflow(groups, nested))
+					return true
+				})
+			} else {
+				stats.count(c.addRecordOrOverflow(groups, value))
+			}
+
+			if c.config.MaxWindows > 0 && len(groups) > nextCheck {
+				// Distinct windows never exceed groups; recount only as groups double
+				if windowsErr = c.checkWindows(groups); windowsErr != nil {
+					return false
+				}
+				nextCheck = 2 * len(groups)
+			}
+
+			if spill != nil {
+				held += len(value.Raw)
+				if held >= c.config.SpillThresholdBytes {
+					if spillErr = spill.write(groups); spillErr != nil {
+						return false
+					}
+					groups = make(map[string]*Group)
+					held = 0
+				}
+			}
+			return true
+		},
+	)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	if windowsErr != nil {
+		return nil, stats, windowsErr
+	}
+
+	if spill != nil {
+		if spillErr != nil {
+			return nil, stats, spillErr
+		}
+
+		var err error
+		if groups, err = spill.merge(groups); err != nil {
+			return nil, stats, err
+		}
+	}
+
+	if c.config.MaxWindows > 0 {
+		if err := c.checkWindows(groups); err != nil {
+			return nil, stats, err
+		}
+	}
+
+	if c.config.WindowMergeGap > 0 {
+		c.mergeWindowGaps(groups)
+	}
+
+	if c.config.DiscardFirstWindow {
+		c.discardFirstWindows(groups)
+	}
+
+	if c.config.MinSamples > 0 {
+		for key, group := range groups {
+			if group.Count < c.config.MinSamples {
+				delete(groups, key)
+			}
+		}
+	}
+
+	stats.Groups = len(groups)
+	return groups, stats, nil
+}
+
+// forEachRecord calls fn with each top-level element of data until fn returns false:
+// the elements of the JSON array, or each non-empty line with InputFormat "ndjson"
+func (c *Compressor) forEachRecord(data []byte, fn func(gjson.Result) bool) error {
+	if c.config.InputFormat != "ndjson" {
+		result := gjson.ParseBytes(data)
+		if !result.IsArray() {
+			return fmt.Errorf("expected JSON array")
+		}
+		result.ForEach(func(_, value gjson.Result) bool { return fn(value) })
+		return nil
+	}
+
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		// A malformed line reaches fn as a non-object and is skipped like one
+		var value gjson.Result
+		if gjson.ValidBytes(line) {
+			value = gjson.ParseBytes(line)
+		}
+		if !fn(value) {
+			break
+		}
+	}
+	return nil
+}
+
+// addRecord adds a single input record to its group, creating the group if needed
+func (c *Compressor) addRecord(groups map[string]*Group, record gjson.Result) recordResult {
+	if !record.IsObject() {
+		return recordSkipped // Skip non-objects
+	}
+
+	timestamp, ok := c.extractTimestamp(record)
+	if !ok {
+		return recordSkipped // Skip if no timestamp
+	}
+
+	if (c.config.MinTimestamp != nil && timestamp < *c.config.MinTimestamp) ||
+		(c.config.MaxTimestamp != nil && timestamp > *c.config.MaxTimestamp) {
+		return recordOutOfRange
+	}
+
+	if c.config.GroupByMissingPolicy == "skip" {
+		for _, field := range c.config.GroupByFields {
+			if !record.Get(field).Exists() {
+				return recordSkipped // Skip records missing a group-by field
+			}
+		}
+	}
+
+	if c.config.SubSampleInterval > 0 && c.addSubSamples(groups, record, timestamp) {
+		return recordAdded
+	}
+
+	if len(c.config.FieldWindows) > 0 {
+		c.addFieldPoints(groups, record, timestamp)
+		return recordAdded
+	}
+
+	c.addPoint(groups, record, timestamp, c.recordValues(record))
+	return recordAdded
+}
+
+// addFieldPoints adds each value field of a record to its own per-field group
+func (c *Compressor) addFieldPoints(groups map[string]*Group, record gjson.Result, timestamp int64) {
+	for _, field := range c.config.ValueFields {
+		v, ok := c.numericValue(record.Get(field))
+		if !ok {
+			continue
+		}
+
+		windowSize := c.recordWindow(record)
+		if window, ok := c.config.FieldWindows[field]; ok && window >= c.unit() {
+			windowSize = c.units(window)
+		}
+
+		c.addPointIn(groups, record, timestamp, windowSize, field, map[string]float64{field: v})
+	}
+}
+
+// overflowKey is the group key of the CollectOverflow group; real keys start with
+// "tenant:" or "window:" or, with HashGroupKeys, are hex SHA-256 digests
+const overflowKey = "overflow"
+
+// addRecordOrOverflow adds a record like addRecord, collecting it into the overflow
+// group when it was rejected and CollectOverflow is set
+func (c *Compressor) addRecordOrOverflow(groups map[string]*Group, record gjson.Result) recordResult {
+	result := c.addRecord(groups, record)
+	if result == recordAdded || !c.config.CollectOverflow || !record.IsObject() {
+		return result
+	}
+
+	values := c.recordValues(record)
+	if len(values) == 0 && len(c.config.ValueFields) > 0 {
+		return result // Nothing to aggregate
+	}
+
+	// Records without a usable timestamp are placed at epoch 0
+	timestamp, ok := c.extractTimestamp(record)
+	if !ok {
+		timestamp = 0
+	}
+
+	group, exists := groups[overflowKey]
+	if !exists {
+		group = &Group{
+			Tags:      make(map[string]string),
+			Fields:    make(map[string]*FieldAggregate),
+			FirstTime: timestamp,
+			LastTime:  timestamp,
+			Method:    c.config.AggregationMethod,
+			Overflow:  true,
+		}
+		groups[overflowKey] = group
+	}
+
+	group.FirstTime = min(group.FirstTime, timestamp)
+	group.LastTime = max(group.LastTime, timestamp)
+	c.addValues(group, record, timestamp, values)
+	group.Count++
+
+	return result
+}
+
+// addValues stores the values of a point in its group, per value field: folded into
+// the field's running aggregate when it has one, appended with their timestamps otherwise
+func (c *Compressor) addValues(group *Group, record gjson.Result, timestamp int64, values map[string]float64) {
+	var tie, orderKey float64
+	if c.config.TieBreakField != "" {
+		tie = record.Get(c.config.TieBreakField).Float()
+	}
+	if c.config.ValueOrderField != "" {
+		orderKey = record.Get(c.config.ValueOrderField).Float()
+	}
+
+	for field, v := range values {
+		f := c.fieldAggregate(group, field)
+		if f.Running != nil {
+			f.Running.add(v, c.recordMultiplicity(record))
+			continue
+		}
+
+		f.Values = append(f.Values, v)
+		f.Times = append(f.Times, timestamp)
+		if c.config.TieBreakField != "" {
+			f.Ties = append(f.Ties, tie)
+		}
+		if c.config.ValueOrderField != "" {
+			f.OrderKeys = append(f.OrderKeys, orderKey)
+		}
+	}
+}
+
+// fieldAggregate returns the state of a value field in a group, creating it on first use
+func (c *Compressor) fieldAggregate(group *Group, field string) *FieldAggregate {
+	if group.Fields == nil {
+		group.Fields = make(map[string]*FieldAggregate)
+	}
+
+	f, ok := group.Fields[field]
+	if !ok {
+		f = &FieldAggregate{Values: make([]float64, 0)}
+		if c.canAccumulate(c.fieldMethod(group, field)) {
+			f.Running = &RunningAggregate{}
+		}
+		group.Fields[field] = f
+	}
+	return f
+}
+
+// canAccumulate reports whether groups using method can keep a running aggregate
+// instead of every value, bounding memory to O(groups) for dense windows
+func (c *Compressor) canAccumulate(method string) bool {
+	if c.config.MultiplicityField == "" && (c.config.ValueOrderField != "" || c.config.SpillThresholdBytes > 0) {
+		// Spilled groups keep their values so merging reproduces the in-memory summation
+		// order. Multiplicities only exist in running aggregates, which spill as well.
+		return false
+	}
+
+	switch method {
+	case "sum", "avg", "mean", "min", "max", "count":
+		return true
+	default:
+		return false
+	}
+}
+
+// recordMultiplicity returns how many times the values of a record occurred: the
+// MultiplicityField value when configured and present, 1 otherwise
+func (c *Compressor) recordMultiplicity(record gjson.Result) int {
+	if c.config.MultiplicityField == "" {
+		return 1
+	}
+	if val := record.Get(c.config.MultiplicityField); val.Exists() {
+		return max(int(val.Int()), 0)
+	}
+	return 1
+}
+
+// recordValues returns the values of the value fields present on a record, keyed by field
+func (c *Compressor) recordValues(record gjson.Result) map[string]float64 {
+	if c.config.SumDuplicateKeys {
+		return c.scaleValues(c.summedRecordValues(record))
+	}
+
+	values := make(map[string]float64, len(c.config.ValueFields))
+	for _, field := range c.config.ValueFields {
+		if field == c.config.TimestampField {
+			continue
+		}
+		if v, ok := c.numericValue(record.Get(field)); ok {
+			values[field] = v
+		}
+	}
+	c.addTimestampValue(record, values)
+	return c.scaleValues(values)
+}
+
+// scaleValues multiplies the values of the fields listed in FieldScales by their scale
+func (c *Compressor) scaleValues(values map[string]float64) map[string]float64 {
+	for field, scale := range c.config.FieldScales {
+		if v, ok := values[field]; ok {
+			values[field] = v * scale
+		}
+	}
+	return values
+}
+
+// addTimestampValue adds the record's timestamp, in epoch seconds as used for
+// windowing, when the timestamp field is also a value field
+func (c *Compressor) addTimestampValue(record gjson.Result, values map[string]float64) {
+	if !slices.Contains(c.config.ValueFields, c.config.TimestampField) {
+		return
+	}
+	if timestamp, ok := c.extractTimestamp(record); ok {
+		values[c.config.TimestampField] = float64(timestamp)
+	}
+}
+
+// summedRecordValues is recordValues summing every occurrence of a value field that
+// is repeated in the record; gjson's Get would return only the first one. Only
+// top-level keys are scanned, nested paths resolve as in recordValues.
+func (c *Compressor) summedRecordValues(record gjson.Result) map[string]float64 {
+	values := make(map[string]float64, len(c.config.ValueFields))
+	for _, field := range c.config.ValueFields {
+		if field != c.config.TimestampField && strings.ContainsAny(field, ".|#*?") {
+			if v, ok := c.numericValue(record.Get(field)); ok {
+				values[field] = v
+			}
+		}
+	}
+
+	record.ForEach(func(key, val gjson.Result) bool {
+		if key.String() == c.config.TimestampField || !slices.Contains(c.config.ValueFields, key.String()) {
+			return true
+		}
+		if v, ok := c.numericValue(val); ok {
+			values[key.String()] += v
+		}
+		return true
+	})
+	c.addTimestampValue(record, values)
+	return values
+}
+
+// numericValue returns the value of a value field, unwrapping objects through
+// ValueSubPath when configured
+func (c *Compressor) numericValue(val gjson.Result) (float64, bool) {
+	if c.config.ValueSubPath != "" && val.IsObject() {
+		val = val.Get(c.config.ValueSubPath)
+		if val.Type != gjson.Number {
+			return 0, false
+		}
+	}
+	return val.Float(), val.Exists()
+}
+
+// addSubSamples expands a record whose value fields hold arrays into one point per
+// array index, spaced SubSampleInterval apart from the record timestamp. Scalar value
+// fields are attributed to the first point. It reports false if no value field is an array.
+func (c *Compressor) addSubSamples(groups map[string]*Group, record gjson.Result, timestamp int64) bool {
+	fields := make([]gjson.Result, len(c.config.ValueFields))
+	points := 0
+	for i, field := range c.config.ValueFields {
+		fields[i] = record.Get(field)
+		if fields[i].IsArray() {
+			points = max(points, len(fields[i].Array()))
+		}
+	}
+	if points == 0 {
+		return false
+	}
+
+	interval := c.units(c.config.SubSampleInterval)
+
+	for idx := 0; idx < points; idx++ {
+		values := make(map[string]float64, len(fields))
+		for i, val := range fields {
+			switch {
+			case val.IsArray():
+				if elems := val.Array(); idx < len(elems) {
+					if v, ok := c.numericValue(elems[idx]); ok {
+						values[c.config.ValueFields[i]] = v
+					}
+				}
+			case idx == 0:
+				if v, ok := c.numericValue(val); ok {
+					values[c.config.ValueFields[i]] = v
+				}
+			}
+		}
+		c.addPoint(groups, record, timestamp+int64(idx)*interval, values)
+	}
+
+	return true
+}
+
+// addPoint adds the values of a single point at timestamp to its group
+func (c *Compressor) addPoint(groups map[string]*Group, record gjson.Result, timestamp int64, values map[string]float64) {
+	c.addPointIn(groups, record, timestamp, c.recordWindow(record), "", values)
+}
+
+// addPointIn adds a point to its group in a window of windowSize, in TimestampUnit.
+// A non-empty valueField restricts the group to that value field.
+func (c *Compressor) addPointIn(
+	groups map[string]*Group, record gjson.Result, timestamp, windowSize int64, valueField string, values map[string]float64,
+) {
+	window := c.windowStart(timestamp, windowSize)
+
+	// The key is composed straight into the digest with HashGroupKeys so that the
+	// readable form is never built
+	var key io.Writer
+	var readable strings.Builder
+	var digest hash.Hash
+	if c.config.HashGroupKeys {
+		digest = sha256.New()
+		key = digest
+	} else {
+		key = &readable
+	}
+
+	tenant := ""
+	if c.config.TenantField != "" {
+		tenant = record.Get(c.config.TenantField).String()
+		fmt.Fprintf(key, "tenant:%s;", tenant)
+	}
+
+	fmt.Fprintf(key, "window:%d", window)
+	if c.config.WindowField != "" || valueField != "" {
+		// Windows of different sizes may start at the same second
+		fmt.Fprintf(key, ";size:%d", windowSize)
+	}
+	if valueField != "" {
+		fmt.Fprintf(key, ";field:%s", valueField)
+	}
+
+	for _, field := range c.config.GroupByFields {
+		if val, ok := c.groupByValue(record, field); ok {
+			fmt.Fprintf(key, ";%s:%s", field, val)
+		}
+	}
+
+	geoHash, hasGeoHash := c.recordGeoHash(record)
+	if hasGeoHash {
+		fmt.Fprintf(key, ";geohash:%s", geoHash)
+	}
+
+	// IMPORTANT: Check UniqueFields - if they are different, do NOT group them.
+	for _, field := range c.config.UniqueFields {
+		if val := record.Get(field); val.Exists() {
+			fmt.Fprintf(key, ";unique_%s:%s", field, val.String())
+		}
+	}
+
+	groupKey := readable.String()
+	if digest != nil {
+		// Hex keeps the key valid UTF-8 so it survives JSON spill files and snapshots
+		var sum [sha256.Size]byte
+		groupKey = hex.EncodeToString(digest.Sum(sum[:0]))
+	}
+
+	group, exists := groups[groupKey]
+	if !exists {
+		group = &Group{
+			Window:     window,
+			WindowSize: windowSize,
+			Tags:       make(map[string]string),
+			Fields:     make(map[string]*FieldAggregate),
+			FirstTime:  timestamp,
+			LastTime:   timestamp,
+			Method:     c.recordMethod(record),
+			Field:      valueField,
+		}
+
+		if c.config.TenantField != "" {
+			group.Tags[c.config.TenantField] = tenant
+		}
+
+		for _, field := range c.config.GroupByFields {
+			if val, ok := c.groupByValue(record, field); ok {
+				group.Tags[field] = val
+			}
+		}
+
+		for _, field := range c.config.UniqueFields {
+			if val := record.Get(field); val.Exists() {
+				group.Tags[field] = val.String()
+			}
+		}
+
+		if hasGeoHash {
+			group.Tags["geohash"] = geoHash
+		}
+
+		groups[groupKey] = group
+	}
+
+	if timestamp < group.FirstTime {
+		group.FirstTime = timestamp
+	}
+	if timestamp > group.LastTime {
+		group.LastTime = timestamp
+	}
+
+	if c.config.Debug {
+		end := record.Index + len(record.Raw)
+		if group.Count == 0 || record.Index < group.SrcStart {
+			group.SrcStart = record.Index
+		}
+		if end > group.SrcEnd {
+			group.SrcEnd = end
+		}
+	}
+
+	c.addValues(group, record, timestamp, values)
+
+	for _, field := range c.config.CollectFields {
+		if val := record.Get(field); val.Exists() {
+			group.collect(field, val.String())
+		}
+	}
+
+	for _, field := range c.config.PassthroughFields {
+		if _, seen := group.Passthrough[field]; seen {
+			continue
+		}
+		if val := record.Get(field); val.Exists() {
+			if group.Passthrough == nil {
+				group.Passthrough = make(map[string]interface{}, len(c.config.PassthroughFields))
+			}
+			group.Passthrough[field] = val.Value()
+		}
+	}
+
+	group.Count++
+}
+
+// groupByValue returns the value of a group-by field, applying GroupByMissingPolicy when it is absent
+func (c *Compressor) groupByValue(record gjson.Result, field string) (string, bool) {
+	if val := record.Get(field); val.Exists() {
+		return val.String(), true
+	}
+
+	switch c.config.GroupByMissingPolicy {
+	case "empty":
+		return "", true
+	case "separate":
+		return missingTagValue, true
+	default:
+		return "", false
+	}
+}
+
+// recordGeoHash returns the geohash of a record's coordinates when geo bucketing is enabled
+func (c *Compressor) recordGeoHash(record gjson.Result) (string, bool) {
+	if c.config.GeoHashFields[0] == "" {
+		return "", false
+	}
+
+	lat := record.Get(c.config.GeoHashFields[0])
+	lon := record.Get(c.config.GeoHashFields[1])
+	if lat.Type != gjson.Number || lon.Type != gjson.Number {
+		return "", false
+	}
+
+	return geohash(lat.Float(), lon.Float(), c.config.GeoHashPrecision), true
+}
+
+// recordWindow returns the window size in TimestampUnit for a record: the value of
+// WindowField, in seconds, when it holds a positive number, TimeWindow otherwise
+func (c *Compressor) recordWindow(record gjson.Result) int64 {
+	if c.config.WindowField != "" {
+		if val := record.Get(c.config.WindowField); val.Type == gjson.Number && val.Int() > 0 {
+			return val.Int() * c.units(time.Second)
+		}
+	}
+
+	return c.windowUnits()
+}
+
+// windowUnits returns the configured TimeWindow in TimestampUnit
+func (c *Compressor) windowUnits() int64 {
+	window := c.units(c.config.TimeWindow)
+	if window == 0 {
+		window = c.units(time.Minute)
+	}
+	return window
+}
+
+// windowStart returns the start of the window containing timestamp, aligned to
+// WindowReference plus WindowOffset rather than the Unix epoch when they are set
+func (c *Compressor) windowStart(timestamp, windowSize int64) int64 {
+	reference := c.config.WindowReference + c.units(c.config.WindowOffset)
+	offset := timestamp - reference
+	n := offset / windowSize
+	if offset%windowSize < 0 {
+		n-- // floor division for timestamps before the reference
+	}
+	return reference + n*windowSize
+}
+
+// extractTimestamp returns the record timestamp and whether the record should be processed
+func (c *Compressor) extractTimestamp(record gjson.Result) (int64, bool) {
+	if c.config.TimestampFunc != nil {
+		return c.config.TimestampFunc(record)
+	}
+
+	// Zero and negative epochs are valid; only missing or unparsable timestamps skip
+	var timestamp int64
+	value := record.Get(c.config.TimestampField)
+	switch {
+	case value.Type == gjson.String:
+		if ts, ok := c.parseTimestamp(value.Str); ok {
+			return ts, true
+		}
+		ts, err := strconv.ParseInt(value.Str, 10, 64)
+		if err != nil || c.config.TimestampFormat == "rfc3339" {
+			return 0, false
+		}
+		timestamp = ts
+	case value.Type == gjson.Number && c.config.TimestampFormat != "rfc3339":
+		timestamp = value.Int()
+	default:
+		return 0, false
+	}
+
+	if c.config.TimestampFormat == "unixms" {
+		timestamp = c.fromMillis(timestamp)
+	}
+	return timestamp, true
 }
 
-type Config struct {
-	TimestampField string   // Field with timestamp (default: "timestamp")
-	ValueFields    []string // Fields with values for aggregation (default: ["value"])
-	GroupByFields  []string // Fields for grouping (for example: ["host", "service"])
+// parseTimestamp parses an RFC 3339 timestamp string into an epoch timestamp in
+// TimestampUnit; strings are rejected under "unixms"
+func (c *Compressor) parseTimestamp(value string) (int64, bool) {
+	if c.config.TimestampFormat == "unixms" {
+		return 0, false
+	}
+	// RFC3339 strings may carry a numeric offset; Unix() normalizes to UTC epoch
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, false
+	}
 
-	// Правила агрегации
-	AggregationMethod string        // "sum", "avg", "min", "max", "count", "last", "first"
-	TimeWindow        time.Duration // Time window for grouping (default: 1 minute)
+	switch c.unit() {
+	case time.Millisecond:
+		return t.UnixMilli(), true
+	case time.Microsecond:
+		return t.UnixMicro(), true
+	case time.Nanosecond:
+		return t.UnixNano(), true
+	default:
+		return t.Unix(), true
+	}
+}
 
-	UniqueFields []string // Fields that must match for aggregation (for example: ["customer_id"])
-	// If customer_id is different - do NOT aggregate, even if host is the same
+// formatTimestamp renders an epoch timestamp in TimestampFormat for output rows
+func (c *Compressor) formatTimestamp(timestamp int64) interface{} {
+	switch c.config.TimestampFormat {
+	case "unixms":
+		return c.toMillis(timestamp)
+	case "rfc3339":
+		return c.unitTime(timestamp).UTC().Format(time.RFC3339Nano)
+	default:
+		return timestamp
+	}
+}
 
-	Workers int // Number of Forkers for parallel processing
+// unit returns the duration of one TimestampUnit
+func (c *Compressor) unit() time.Duration {
+	switch c.config.TimestampUnit {
+	case "ms":
+		return time.Millisecond
+	case "us":
+		return time.Microsecond
+	case "ns":
+		return time.Nanosecond
+	default:
+		return time.Second
+	}
 }
 
-func DefaultConfig() *Config {
-	return &Config{
-		TimestampField:    "timestamp",
-		ValueFields:       []string{"value"},
-		AggregationMethod: "sum",
-		TimeWindow:        time.Minute,
-		Workers:           4,
+// units converts a duration to whole TimestampUnits
+func (c *Compressor) units(d time.Duration) int64 {
+	return int64(d / c.unit())
+}
+
+// unitTime converts an epoch timestamp in TimestampUnit to a time
+func (c *Compressor) unitTime(timestamp int64) time.Time {
+	switch c.unit() {
+	case time.Millisecond:
+		return time.UnixMilli(timestamp)
+	case time.Microsecond:
+		return time.UnixMicro(timestamp)
+	case time.Nanosecond:
+		return time.Unix(0, timestamp)
+	default:
+		return time.Unix(timestamp, 0)
 	}
 }
 
-func NewCompressor(config *Config) *Compressor {
-	if config == nil {
-		config = DefaultConfig()
+// fromMillis converts epoch milliseconds to TimestampUnit, rounding down
+func (c *Compressor) fromMillis(ms int64) int64 {
+	if unit := c.unit(); unit >= time.Millisecond {
+		return floorDiv(ms, int64(unit/time.Millisecond))
 	}
+	return ms * int64(time.Millisecond/c.unit())
+}
 
-	if config.TimestampField == "" {
-		config.TimestampField = "timestamp"
+// toMillis converts an epoch timestamp in TimestampUnit to milliseconds, rounding down
+func (c *Compressor) toMillis(timestamp int64) int64 {
+	if unit := c.unit(); unit >= time.Millisecond {
+		return timestamp * int64(unit/time.Millisecond)
 	}
-	if len(config.ValueFields) == 0 {
-		config.ValueFields = []string{"value"}
+	return floorDiv(timestamp, int64(time.Millisecond/c.unit()))
+}
+
+// rowTime reads back the timestamp of a decoded output row in TimestampUnit
+func (c *Compressor) rowTime(row map[string]interface{}) int64 {
+	switch v := row[c.config.TimestampField].(type) {
+	case string:
+		timestamp, _ := c.parseTimestamp(v)
+		return timestamp
+	default:
+		timestamp := toInt64(v)
+		if c.config.TimestampFormat == "unixms" {
+			timestamp = c.fromMillis(timestamp)
+		}
+		return timestamp
 	}
-	const defaultAggregation = "sum"
-	if config.AggregationMethod == "" {
-		config.AggregationMethod = defaultAggregation
+}
+
+// floorDiv divides a by b rounding towards negative infinity
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
 	}
-	if config.TimeWindow == 0 {
-		config.TimeWindow = time.Minute
+	return q
+}
+
+// buildRow converts an aggregated group into an output object
+func (c *Compressor) buildRow(group *Group) map[string]interface{} {
+	if c.config.RowBuilder != nil {
+		return c.config.RowBuilder(group, c.groupAggregates(group))
 	}
-	if config.Workers <= 0 {
-		config.Workers = 4
+
+	obj := make(map[string]interface{})
+
+	timestamp := c.rowTimestamp(group)
+	obj[c.config.TimestampField] = c.formatTimestamp(timestamp)
+
+	if c.config.EmitISOTimestamp {
+		obj["timestamp_iso"] = c.isoTimestamp(timestamp)
 	}
 
-	return &Compressor{
-		config: *config,
+	values, tags := obj, obj
+	if c.config.NestedOutput {
+		values = make(map[string]interface{})
+		tags = make(map[string]interface{}, len(group.Tags)+len(group.Collected))
+		obj["values"] = values
+		obj["tags"] = tags
 	}
-}
 
-func (c *Compressor) CompressJSON(data []byte) ([]byte, error) {
-	result := gjson.ParseBytes(data)
-	if !result.IsArray() {
-		return nil, fmt.Errorf("expected JSON array")
+	for field, value := range c.groupAggregates(group) {
+		values[field] = value
 	}
 
-	groups := make(map[string]*Group)
+	for k, v := range group.Tags {
+		tags[k] = v
+	}
 
-	result.ForEach(
-		func(key, value gjson.Result) bool {
-			if !value.IsObject() {
-				return true // Skip non-objects
-			}
+	for field, collected := range group.Collected {
+		tags[field] = collected
+	}
 
-			timestamp := value.Get(c.config.TimestampField).Int()
-			if timestamp == 0 {
-				return true // Skip if no timestamp
-			}
+	for field, value := range group.Passthrough {
+		tags[field] = value
+	}
 
-			// Time window in seconds
-			windowSec := int64(c.config.TimeWindow.Seconds())
-			if windowSec == 0 {
-				windowSec = 60
-			}
-			window := (timestamp / windowSec) * windowSec
+	if group.Overflow {
+		tags["_overflow"] = true
+	}
 
-			groupKey := fmt.Sprintf("window:%d", window)
+	if c.config.EmitRate {
+		span := float64(group.LastTime-group.FirstTime) * c.unit().Seconds()
+		obj["span_seconds"] = span
+		if span > 0 {
+			obj["sample_rate"] = float64(group.Count) / span
+		} else {
+			obj["sample_rate"] = float64(0)
+		}
+	}
 
-			for _, field := range c.config.GroupByFields {
-				if val := value.Get(field); val.Exists() {
-					groupKey += fmt.Sprintf(";%s:%s", field, val.String())
-				}
-			}
+	if c.config.EmitCount {
+		obj[c.config.CountField] = group.Count
+	}
 
-			// IMPORTANT: Check UniqueFields - if they are different, do NOT group them.
-			for _, field := range c.config.UniqueFields {
-				if val := value.Get(field); val.Exists() {
-					groupKey += fmt.Sprintf(";unique_%s:%s", field, val.String())
-				}
-			}
+	if c.config.EmitDataBounds {
+		obj["data_first"] = group.FirstTime
+		obj["data_last"] = group.LastTime
+	}
 
-			group, exists := groups[groupKey]
-			if !exists {
-				group = &Group{
-					Window:    window,
-					Tags:      make(map[string]string),
-					Values:    make([]float64, 0),
-					FirstTime: timestamp,
-					LastTime:  timestamp,
-				}
+	if c.config.Debug {
+		obj["_src_start"] = group.SrcStart
+		obj["_src_end"] = group.SrcEnd
+	}
 
-				for _, field := range c.config.GroupByFields {
-					if val := value.Get(field); val.Exists() {
-						group.Tags[field] = val.String()
-					}
-				}
+	return obj
+}
 
-				for _, field := range c.config.UniqueFields {
-					if val := value.Get(field); val.Exists() {
-						group.Tags[field] = val.String()
-					}
-				}
+// groupAggregates returns the aggregated values of a group keyed by output field
+func (c *Compressor) groupAggregates(group *Group) map[string]float64 {
+	keys := c.groupValueKeys(group)
+	aggregates := make(map[string]float64, len(keys))
+	for _, key := range keys {
+		aggregates[c.outputField(key)] = c.fieldValue(group, key)
+	}
+	return aggregates
+}
 
-				groups[groupKey] = group
-			}
+// outputField returns the output key of a value field: its OutputFieldNames entry, the
+// field itself, or "<field>_value" for the timestamp field so it does not replace the
+// row timestamp
+func (c *Compressor) outputField(field string) string {
+	if name, ok := c.config.OutputFieldNames[field]; ok {
+		return name
+	}
+	if field == c.config.TimestampField {
+		return field + "_value"
+	}
+	return field
+}
 
-			if timestamp < group.FirstTime {
-				group.FirstTime = timestamp
-			}
-			if timestamp > group.LastTime {
-				group.LastTime = timestamp
-			}
+// groupValueKeys returns the output fields of a group: its own field in FieldWindows
+// mode, otherwise the valueKeys that occurred in the group
+func (c *Compressor) groupValueKeys(group *Group) []string {
+	if group.Field != "" {
+		return []string{group.Field}
+	}
+	if len(c.config.ValueFields) == 0 {
+		return c.valueKeys()
+	}
 
-			for _, field := range c.config.ValueFields {
-				if val := value.Get(field); val.Exists() {
-					group.Values = append(group.Values, val.Float())
-				}
-			}
+	keys := make([]string, 0, len(c.config.ValueFields))
+	for _, field := range c.config.ValueFields {
+		if _, ok := group.Fields[field]; ok {
+			keys = append(keys, field)
+		}
+	}
+	return keys
+}
 
-			group.Count++
+// outputKey returns the stable key of a group's row under OutputAsObject
+func (c *Compressor) outputKey(group *Group) string {
+	if group.Overflow {
+		return overflowKey
+	}
 
-			return true
-		},
-	)
+	keys := make([]string, 0, len(group.Tags))
+	for k := range group.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	output := make([]map[string]interface{}, 0, len(groups))
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s=%s;", k, group.Tags[k])
+	}
+	fmt.Fprintf(&sb, "window=%d", group.Window)
+	if c.config.WindowField != "" || group.Field != "" {
+		fmt.Fprintf(&sb, ";size=%d", group.WindowSize)
+	}
+	if group.Field != "" {
+		fmt.Fprintf(&sb, ";field=%s", group.Field)
+	}
+	return sb.String()
+}
 
-	for _, group := range groups {
-		aggregatedValue := c.aggregate(group.Values)
+// rowTimestamp returns the timestamp emitted for a group
+func (c *Compressor) rowTimestamp(group *Group) int64 {
+	var timestamp int64
+	switch group.Method {
+	case "first":
+		timestamp = group.FirstTime
+	case "last":
+		timestamp = group.LastTime
+	default:
+		timestamp = (group.FirstTime + group.LastTime) / 2
+	}
 
-		obj := make(map[string]interface{})
+	if round := c.units(c.config.TimestampRound); round > 1 {
+		// Round to the nearest multiple, halves up
+		shifted := timestamp + round/2
+		timestamp = shifted - ((shifted%round)+round)%round
+	}
+	return timestamp
+}
 
-		switch c.config.AggregationMethod {
-		case "first":
-			obj[c.config.TimestampField] = group.FirstTime
-		case "last":
-			obj[c.config.TimestampField] = group.LastTime
-		default:
-			obj[c.config.TimestampField] = (group.FirstTime + group.LastTime) / 2
-		}
+// isoTimestamp formats a row timestamp as RFC 3339 in ISOLocation
+func (c *Compressor) isoTimestamp(timestamp int64) string {
+	loc := c.config.ISOLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	return c.unitTime(timestamp).In(loc).Format(time.RFC3339)
+}
 
-		if len(c.config.ValueFields) == 1 {
-			obj[c.config.ValueFields[0]] = aggregatedValue
-		} else {
-			obj["value"] = aggregatedValue
+// groupValue returns the aggregated value of a group's first output field, 0 when
+// none of the value fields occurred in the group
+func (c *Compressor) groupValue(group *Group) float64 {
+	keys := c.groupValueKeys(group)
+	if len(keys) == 0 {
+		return 0
+	}
+	return c.fieldValue(group, keys[0])
+}
+
+// fieldValue returns the aggregated value of one value field of a group, which must
+// be one of its groupValueKeys
+func (c *Compressor) fieldValue(group *Group, field string) float64 {
+	if len(c.config.ValueFields) == 0 {
+		// Count-only mode: every record in the group counts, with or without a value
+		return float64(group.Count)
+	}
+
+	f := group.Fields[field]
+	method := c.fieldMethod(group, field)
+	if f.Running != nil {
+		return c.clamp(f.Running.result(method))
+	}
+
+	if c.config.ValueOrderField != "" && len(f.OrderKeys) == len(f.Values) {
+		// Explicit ordering replaces input/chronological order for every method
+		sort.Stable(byOrderKey{f})
+		return c.clamp(c.aggregate(f.Values, method))
+	}
+
+	switch method {
+	case "first", "last":
+		if len(f.Values) > 0 && len(f.Times) == len(f.Values) {
+			return c.clamp(f.Values[f.chronologicalIndex(method == "last")])
 		}
+	case "auto":
+		return c.clamp(c.autoAggregate(f))
+	case "rate":
+		return c.clamp(c.rate(group, f))
+	}
+	return c.clamp(c.aggregate(f.Values, method))
+}
+
+// rate returns the per-second rate of a field: the sum of its values over the span
+// between the group's first and last sample, or over DefaultSampleInterval for a
+// single sample. Without a span or interval the rate is 0.
+func (c *Compressor) rate(group *Group, f *FieldAggregate) float64 {
+	span := float64(group.LastTime-group.FirstTime) * c.unit().Seconds()
+	if span <= 0 {
+		span = c.config.DefaultSampleInterval.Seconds()
+	}
+	if span <= 0 {
+		return 0
+	}
+	return c.aggregate(f.Values, "sum") / span
+}
+
+// clamp bounds an aggregated value to [ClampMin, ClampMax], and to non-negative values with NonNegative
+func (c *Compressor) clamp(value float64) float64 {
+	if c.config.NonNegative && value < 0 {
+		value = 0
+	}
+	if c.config.ClampMin != nil && value < *c.config.ClampMin {
+		return *c.config.ClampMin
+	}
+	if c.config.ClampMax != nil && value > *c.config.ClampMax {
+		return *c.config.ClampMax
+	}
+	return value
+}
 
-		for k, v := range group.Tags {
-			obj[k] = v
+// recordMethod returns the aggregation method for the group a record starts
+func (c *Compressor) recordMethod(record gjson.Result) string {
+	if c.config.MethodTagField != "" {
+		if method, ok := c.config.MethodByTag[record.Get(c.config.MethodTagField).String()]; ok {
+			return method
 		}
+	}
+	return c.config.AggregationMethod
+}
+
+// fieldMethod returns the aggregation method of a value field within a group
+func (c *Compressor) fieldMethod(group *Group, field string) string {
+	if method, ok := c.config.FieldMethods[field]; ok {
+		return method
+	}
+	return group.Method
+}
 
-		output = append(output, obj)
+// valueKeys returns the output fields holding the aggregated values: one per value
+// field, or "count" in count-only mode
+func (c *Compressor) valueKeys() []string {
+	if len(c.config.ValueFields) == 0 {
+		return []string{"count"}
 	}
+	return c.config.ValueFields
+}
 
-	return json.Marshal(output)
+// KnownMethod reports whether method is a supported aggregation method; unknown
+// methods aggregate as "sum"
+func KnownMethod(method string) bool {
+	switch method {
+	case "sum", "avg", "mean", "min", "max", "count", "first", "last",
+		"bitor", "bitand", "median", "auto", "rate":
+		return true
+	}
+	_, ok := parsePercentile(method)
+	return ok
 }
 
-func (c *Compressor) aggregate(values []float64) float64 {
+// aggregate reduces values using the given aggregation method
+func (c *Compressor) aggregate(values []float64, method string) float64 {
 	if len(values) == 0 {
 		return 0
 	}
 
-	switch c.config.AggregationMethod {
+	switch method {
 	case "sum":
 		sum := 0.0
 		for _, v := range values {
@@ -229,7 +1736,17 @@ func (c *Compressor) aggregate(values []float64) float64 {
 	case "last":
 		return values[len(values)-1]
 
+	case "bitor", "bitand":
+		return bitwise(values, method == "bitor")
+
+	case "median":
+		return median(values)
+
 	default:
+		if p, ok := parsePercentile(method); ok {
+			return percentile(values, p)
+		}
+
 		// Default to sum
 		sum := 0.0
 		for _, v := range values {
@@ -239,42 +1756,341 @@ func (c *Compressor) aggregate(values []float64) float64 {
 	}
 }
 
+// bitwise ORs or ANDs the integral values together, ignoring values that are
+// not whole numbers representable as int64
+func bitwise(values []float64, or bool) float64 {
+	var result int64
+	seen := false
+
+	for _, v := range values {
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			continue
+		}
+
+		flags := int64(v)
+		switch {
+		case !seen:
+			result = flags
+			seen = true
+		case or:
+			result |= flags
+		default:
+			result &= flags
+		}
+	}
+
+	return float64(result)
+}
+
+// median returns the middle value, or the mean of the two middle values for an even
+// count. values is not modified.
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// parsePercentile parses methods of the form "p95" into a percentile in [0, 100]
+func parsePercentile(method string) (float64, bool) {
+	rest, ok := strings.CutPrefix(method, "p")
+	if !ok {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(rest, 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+// percentile returns the p-th percentile of values, linearly interpolating between
+// the closest ranks. values is not modified.
+func percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
 type Group struct {
-	Window    int64             // Time window
-	Tags      map[string]string // Group Tags.
+	Window     int64                      // Time window
+	WindowSize int64                      // Window length in TimestampUnit
+	Tags       map[string]string          // Group Tags.
+	Count      int                        // Number of records
+	FirstTime  int64                      // First timestamp
+	LastTime   int64                      // Last timestamp
+	Method     string                     // Aggregation method for this group
+	Collected  map[string][]string        // Distinct values of CollectFields in first-seen order
+	Fields     map[string]*FieldAggregate // Values of each value field
+	SrcStart   int                        // Input byte offset of the earliest record, with Config.Debug
+	SrcEnd     int                        // Input byte offset just past the latest record, with Config.Debug
+	Overflow   bool                       // Holds the records collected by Config.CollectOverflow
+	Field      string                     // Value field of the group in FieldWindows mode
+
+	Passthrough map[string]interface{} // First-seen values of PassthroughFields
+
+	collectedSet map[string]map[string]struct{}
+}
+
+// FieldAggregate holds the values of one value field within a group
+type FieldAggregate struct {
 	Values    []float64         // Values for aggregation
-	Count     int               // Number of records
-	FirstTime int64             // First timestamp
-	LastTime  int64             // Last timestamp
+	Times     []int64           // Timestamp of each entry in Values
+	Ties      []float64         // TieBreakField of each entry in Values, when configured
+	OrderKeys []float64         // ValueOrderField of each entry in Values, when configured
+	Running   *RunningAggregate // Replaces Values for associative methods
+}
+
+// RunningAggregate incrementally tracks the state needed by the associative methods
+type RunningAggregate struct {
+	N   int     `json:"n"`
+	Sum float64 `json:"sum"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// add folds in value v occurring n times
+func (r *RunningAggregate) add(v float64, n int) {
+	if n <= 0 {
+		return
+	}
+	if r.N == 0 || v < r.Min {
+		r.Min = v
+	}
+	if r.N == 0 || v > r.Max {
+		r.Max = v
+	}
+	r.Sum += v * float64(n)
+	r.N += n
+}
+
+// merge folds in the values tracked by o
+func (r *RunningAggregate) merge(o *RunningAggregate) {
+	if o.N == 0 {
+		return
+	}
+	if r.N == 0 || o.Min < r.Min {
+		r.Min = o.Min
+	}
+	if r.N == 0 || o.Max > r.Max {
+		r.Max = o.Max
+	}
+	r.Sum += o.Sum
+	r.N += o.N
+}
+
+// result returns the aggregate for method, matching aggregate over the same values
+func (r *RunningAggregate) result(method string) float64 {
+	if r.N == 0 {
+		return 0
+	}
+
+	switch method {
+	case "avg", "mean":
+		return r.Sum / float64(r.N)
+	case "min":
+		return r.Min
+	case "max":
+		return r.Max
+	case "count":
+		return float64(r.N)
+	default:
+		return r.Sum
+	}
+}
+
+// byOrderKey sorts a field's values and their parallel slices by OrderKeys
+type byOrderKey struct{ g *FieldAggregate }
+
+func (b byOrderKey) Len() int           { return len(b.g.OrderKeys) }
+func (b byOrderKey) Less(i, j int) bool { return b.g.OrderKeys[i] < b.g.OrderKeys[j] }
+func (b byOrderKey) Swap(i, j int) {
+	g := b.g
+	g.OrderKeys[i], g.OrderKeys[j] = g.OrderKeys[j], g.OrderKeys[i]
+	g.Values[i], g.Values[j] = g.Values[j], g.Values[i]
+	if len(g.Times) == len(g.OrderKeys) {
+		g.Times[i], g.Times[j] = g.Times[j], g.Times[i]
+	}
+	if len(g.Ties) == len(g.OrderKeys) {
+		g.Ties[i], g.Ties[j] = g.Ties[j], g.Ties[i]
+	}
+}
+
+// chronologicalIndex returns the index of the earliest (or latest) value. Values sharing
+// a timestamp are ordered by Ties when present, otherwise by input order.
+func (g *FieldAggregate) chronologicalIndex(latest bool) int {
+	best := 0
+	for i := 1; i < len(g.Times); i++ {
+		cmp := g.Times[i] - g.Times[best]
+		if cmp == 0 && len(g.Ties) == len(g.Times) {
+			switch {
+			case g.Ties[i] > g.Ties[best]:
+				cmp = 1
+			case g.Ties[i] < g.Ties[best]:
+				cmp = -1
+			}
+		}
+
+		if (latest && cmp >= 0) || (!latest && cmp < 0) {
+			best = i
+		}
+	}
+	return best
+}
+
+// collect records a distinct value of a collected field
+func (g *Group) collect(field, value string) {
+	if g.collectedSet == nil {
+		// Rebuild the index from Collected, which may have been restored from a snapshot
+		g.collectedSet = make(map[string]map[string]struct{})
+		if g.Collected == nil {
+			g.Collected = make(map[string][]string)
+		}
+		for f, values := range g.Collected {
+			g.collectedSet[f] = make(map[string]struct{}, len(values))
+			for _, v := range values {
+				g.collectedSet[f][v] = struct{}{}
+			}
+		}
+	}
+	seen, ok := g.collectedSet[field]
+	if !ok {
+		seen = make(map[string]struct{})
+		g.collectedSet[field] = seen
+	}
+	if _, dup := seen[value]; dup {
+		return
+	}
+	seen[value] = struct{}{}
+	g.Collected[field] = append(g.Collected[field], value)
 }
 
-// CompressBatch processes several batches in parallel
+// CompressBatch processes several batches in parallel. A batch that fails to
+// compress yields nil; use CompressBatchWithErrors to tell why.
 func (c *Compressor) CompressBatch(batches [][]byte) [][]byte {
+	results, _ := c.CompressBatchWithErrors(batches)
+	return results
+}
+
+// CompressBatchWithErrors is CompressBatch that also returns the error of each batch,
+// nil for batches that compressed. results[i] is nil whenever errs[i] is not.
+func (c *Compressor) CompressBatchWithErrors(batches [][]byte) ([][]byte, []error) {
+	return c.compressBatch(context.Background(), batches)
+}
+
+// CompressBatchContext is CompressBatch that stops dispatching batches once ctx is
+// cancelled and then returns ctx.Err(). Batches already being compressed finish;
+// batches never started are left nil. Without cancellation the error joins those of
+// the failed batches.
+func (c *Compressor) CompressBatchContext(ctx context.Context, batches [][]byte) ([][]byte, error) {
+	results, errs := c.compressBatch(ctx, batches)
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("batch %d: %w", i, err))
+		}
+	}
+	return results, errors.Join(failed...)
+}
+
+// compressBatch compresses batches on up to Workers goroutines, recording ctx.Err()
+// for the batches not started before ctx is cancelled
+func (c *Compressor) compressBatch(ctx context.Context, batches [][]byte) ([][]byte, []error) {
 	results := make([][]byte, len(batches))
+	errs := make([]error, len(batches))
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, c.config.Workers)
 
 	for i, batch := range batches {
-		wg.Add(1)
-		semaphore <- struct{}{}
+		if ctx.Err() == nil {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
 
+		wg.Add(1)
 		go func(idx int, data []byte) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
-			if compressed, err := c.CompressJSON(data); err == nil {
-				results[idx] = compressed
-			}
+			results[idx], errs[idx] = c.CompressJSON(data)
 		}(i, batch)
 	}
 
 	wg.Wait()
-	return results
+	return results, errs
 }
 
 func (c *Compressor) GetCompressionRatio(input, output []byte) float64 {
-	if len(input) == 0 {
-		return 0
+	return compressionRatio(len(input), len(output))
+}
+
+// GetClampedCompressionRatio returns GetCompressionRatio clamped to [0, 1], so
+// payloads that grew when compressed report no reduction instead of a negative one
+func (c *Compressor) GetClampedCompressionRatio(input, output []byte) float64 {
+	return math.Max(0, math.Min(1, c.GetCompressionRatio(input, output)))
+}
+
+// SelfTest compresses a small synthetic payload built from the configured fields
+// and verifies that the output is valid JSON, or NDJSON with OutputFormat "ndjson".
+// The number of rows is not checked: FieldWindows, DiscardFirstWindow or MinSamples
+// legitimately split or drop the synthetic records.
+func (c *Compressor) SelfTest() error {
+	record := map[string]interface{}{c.config.TimestampField: c.formatTimestamp(1000)}
+	for _, field := range c.config.ValueFields {
+		record[field] = 1
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	data := []byte("[" + string(encoded) + "," + string(encoded) + "]")
+	if c.config.InputFormat == "ndjson" {
+		data = []byte(string(encoded) + "\n" + string(encoded) + "\n")
+	}
+
+	compressed, err := c.CompressJSON(data)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+
+	values := 0
+	decoder := json.NewDecoder(bytes.NewReader(compressed))
+	for {
+		var value interface{}
+		if err := decoder.Decode(&value); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("self-test: invalid output: %w", err)
+		}
+		values++
 	}
-	return 1.0 - float64(len(output))/float64(len(input))
+
+	// Only NDJSON output may be empty, when no row is emitted
+	if values == 0 && c.config.OutputFormat != "ndjson" {
+		return errors.New("self-test: empty output")
+	}
+	if values > 1 && c.config.OutputFormat != "ndjson" {
+		return errors.New("self-test: invalid output: more than one JSON value")
+	}
+
+	return nil
 }
@@ -1,7 +1,9 @@
 package compressor
 
 import (
+	"context"
 	"encoding/json"
+	"slices"
 	"testing"
 	"time"
 
@@ -85,18 +87,26 @@ func TestCompressJSON_MissingTimestamp(t *testing.T) {
 func TestCompressJSON_ZeroTimestamp(t *testing.T) {
 	c := NewCompressor(nil)
 
-	// Objects with zero timestamp - should skip them
+	// Epoch zero and pre-1970 timestamps are kept; a missing or null timestamp is skipped
 	input := `[
 		{"timestamp": 0, "value": 10},
-		{"timestamp": 1000, "value": 20}
+		{"timestamp": -1000, "value": 30},
+		{"timestamp": 1000, "value": 20},
+		{"timestamp": null, "value": 40},
+		{"value": 50}
 	]`
 	result, err := c.CompressJSON([]byte(input))
 	require.NoError(t, err)
 
 	var output []map[string]interface{}
 	require.NoError(t, json.Unmarshal(result, &output))
-	require.Len(t, output, 1)
-	require.Equal(t, float64(20), output[0]["value"])
+	require.Len(t, output, 3)
+
+	values := make(map[float64]float64)
+	for _, row := range output {
+		values[row["timestamp"].(float64)] = row["value"].(float64)
+	}
+	require.Equal(t, map[float64]float64{0: 10, -1000: 30, 1000: 20}, values)
 }
 
 func TestCompressJSON_ZeroWindowSec(t *testing.T) {
@@ -203,7 +213,7 @@ func TestAggregation_Methods(t *testing.T) {
 
 func TestAggregation_EmptyValues(t *testing.T) {
 	c := NewCompressor(nil)
-	result := c.aggregate([]float64{})
+	result := c.aggregate([]float64{}, c.config.AggregationMethod)
 	require.Equal(t, float64(0), result)
 }
 
@@ -227,7 +237,7 @@ func TestAggregation_SingleValue(t *testing.T) {
 				AggregationMethod: tt.method,
 			}
 			c := NewCompressor(config)
-			result := c.aggregate([]float64{5})
+			result := c.aggregate([]float64{5}, c.config.AggregationMethod)
 			require.Equal(t, tt.expected, result)
 		})
 	}
@@ -263,6 +273,66 @@ func TestCompressBatch(t *testing.T) {
 	require.Equal(t, float64(30), output[0]["val"])
 }
 
+func TestCompressBatchWithErrors(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"val"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		Workers:           2,
+	})
+
+	results, errs := c.CompressBatchWithErrors([][]byte{
+		[]byte(`[{"ts": 1000, "val": 10}]`),
+		[]byte(`[]`),
+		[]byte(`invalid json`),
+	})
+	require.Len(t, results, 3)
+	require.Len(t, errs, 3)
+
+	require.NoError(t, errs[0])
+	require.JSONEq(t, `[{"ts": 1000, "val": 10}]`, string(results[0]))
+
+	// An empty batch compresses to nothing, distinguishable from a failed one
+	require.NoError(t, errs[1])
+	require.JSONEq(t, `[]`, string(results[1]))
+
+	require.ErrorContains(t, errs[2], "expected JSON array")
+	require.Nil(t, results[2])
+}
+
+func TestCompressBatchContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel once the first batch is compressed; one worker keeps the rest waiting
+	c := NewCompressor(&Config{
+		TimestampField: "ts",
+		ValueFields:    []string{"val"},
+		TimeWindow:     60 * time.Second,
+		Workers:        1,
+		OnComplete:     func(CompressionStats) { cancel() },
+	})
+
+	batch := []byte(`[{"ts": 1000, "val": 10}]`)
+	results, err := c.CompressBatchContext(ctx, [][]byte{batch, batch, batch})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, results, 3)
+	require.JSONEq(t, `[{"ts": 1000, "val": 10}]`, string(results[0]))
+	require.Nil(t, results[1])
+	require.Nil(t, results[2])
+
+	// Without cancellation the error names the failed batches
+	results, err = NewCompressor(nil).CompressBatchContext(context.Background(), [][]byte{batch, []byte(`invalid`)})
+	require.ErrorContains(t, err, "batch 1: expected JSON array")
+	require.NotNil(t, results[0])
+	require.Nil(t, results[1])
+
+	results, err = NewCompressor(nil).CompressBatchContext(context.Background(), [][]byte{batch})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+}
+
 func TestGetCompressionRatio(t *testing.T) {
 	c := NewCompressor(nil)
 
@@ -297,7 +367,185 @@ func TestCompressJSON_MultipleValueFields(t *testing.T) {
 	var output []map[string]interface{}
 	require.NoError(t, json.Unmarshal(result, &output))
 	require.Len(t, output, 1)
-	
-	// When multiple value fields, it uses "value" as the output field
-	require.Equal(t, float64(255), output[0]["value"]) // sum of all values: 50+70+60+75
-}
\ No newline at end of file
+
+	// Each value field is aggregated independently under its own key
+	require.Equal(t, float64(110), output[0]["cpu"])
+	require.Equal(t, float64(145), output[0]["mem"])
+	require.NotContains(t, output[0], "value")
+}
+func TestAggregation_Bitwise(t *testing.T) {
+	tests := []struct {
+		method   string
+		values   []float64
+		expected float64
+	}{
+		{"bitor", []float64{0b001, 0b010}, 0b011},
+		{"bitor", []float64{0b001, 0b001, 0b100}, 0b101},
+		{"bitand", []float64{0b111, 0b110, 0b011}, 0b010},
+		{"bitand", []float64{0b001, 0b010}, 0},
+		{"bitor", []float64{0b001, 2.5, 0b100}, 0b101}, // non-integral values are ignored
+		{"bitand", []float64{1.5}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			c := NewCompressor(&Config{AggregationMethod: tt.method})
+			require.Equal(t, tt.expected, c.aggregate(tt.values, c.config.AggregationMethod))
+		})
+	}
+}
+
+func TestAggregation_Median(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		expected float64
+	}{
+		{"odd", []float64{7, 1, 3}, 3},
+		{"even", []float64{4, 1, 3, 10}, 3.5},
+		{"single", []float64{42}, 42},
+	}
+
+	c := NewCompressor(&Config{AggregationMethod: "median"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.values)
+			require.Equal(t, tt.expected, c.aggregate(input, c.config.AggregationMethod))
+			require.Equal(t, tt.values, input) // the input order is preserved
+		})
+	}
+}
+
+func TestAggregation_Percentile(t *testing.T) {
+	values := []float64{15, 1, 9, 3, 12, 7, 20, 4}
+	c := NewCompressor(nil)
+
+	require.Equal(t, c.aggregate(values, "median"), c.aggregate(values, "p50"))
+	require.Equal(t, float64(1), c.aggregate(values, "p0"))
+	require.Equal(t, float64(20), c.aggregate(values, "p100"))
+	require.InDelta(t, 18.25, c.aggregate(values, "p95"), 1e-9) // between 15 and 20 at rank 6.65
+	require.InDelta(t, 19.65, c.aggregate(values, "p99"), 1e-9)
+	require.Equal(t, float64(71), c.aggregate(values, "p150")) // invalid, falls back to sum
+	require.Equal(t, float64(71), c.aggregate(values, "pmax"))
+	require.Equal(t, []float64{15, 1, 9, 3, 12, 7, 20, 4}, values)
+}
+
+func TestCompressJSON_FlattenNestedArrays(t *testing.T) {
+	input := `[
+		[{"timestamp": 1000, "value": 1}, {"timestamp": 1010, "value": 2}],
+		{"timestamp": 1015, "value": 4},
+		[[{"timestamp": 1018, "value": 100}]],
+		[1, null]
+	]`
+
+	// Default: nested arrays are skipped like any other non-object
+	result, err := NewCompressor(nil).CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(4), output[0]["value"])
+
+	// Flattened: one level of nesting is descended, deeper levels are still skipped
+	config := DefaultConfig()
+	config.FlattenNestedArrays = true
+
+	result, err = NewCompressor(config).CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(7), output[0]["value"])
+}
+
+func TestCompressJSON_EmptyInputPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected string
+		err      error
+	}{
+		{"", `[]`, nil},
+		{"empty", `[]`, nil},
+		{"null", `null`, nil},
+		{"error", ``, ErrEmptyInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			config := DefaultConfig()
+			config.EmptyInputPolicy = tt.policy
+			c := NewCompressor(config)
+
+			result, err := c.CompressJSON([]byte(`[]`))
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(result))
+
+			// Non-empty input whose records are all skipped is not affected
+			result, err = c.CompressJSON([]byte(`[{"no_timestamp": 1}]`))
+			require.NoError(t, err)
+			require.Equal(t, `[]`, string(result))
+		})
+	}
+}
+
+func TestCompressJSON_MaxWindows(t *testing.T) {
+	config := DefaultConfig()
+	config.TimeWindow = time.Second
+	config.MaxWindows = 100
+
+	// A wide timestamp range with one-second windows
+	records := make([]map[string]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		records = append(records, map[string]interface{}{"timestamp": 1000 + i*1000, "value": 1})
+	}
+	input, err := json.Marshal(records)
+	require.NoError(t, err)
+
+	_, err = NewCompressor(config).CompressJSON(input)
+	require.ErrorContains(t, err, "more than 100 windows")
+
+	// Many groups within few windows are fine
+	config.GroupByFields = []string{"host"}
+	records = records[:0]
+	for i := 0; i < 1000; i++ {
+		records = append(records, map[string]interface{}{"timestamp": 1000 + i%50, "value": 1, "host": i})
+	}
+	input, err = json.Marshal(records)
+	require.NoError(t, err)
+
+	result, err := NewCompressor(config).CompressJSON(input)
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1000)
+}
+
+func TestCompressJSON_MultipleValueFieldsMissing(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem"},
+		AggregationMethod: "avg",
+		TimeWindow:        60 * time.Second,
+	}
+	c := NewCompressor(config)
+
+	// mem is absent from the second record and must not drag its average down
+	input := `[
+		{"ts": 1000, "cpu": 50, "mem": 70},
+		{"ts": 1010, "cpu": 60}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(55), output[0]["cpu"])
+	require.Equal(t, float64(70), output[0]["mem"])
+}
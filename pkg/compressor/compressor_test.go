@@ -3,10 +3,13 @@ package compressor
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 func TestCompressor_SimpleAggregation(t *testing.T) {
@@ -154,6 +157,112 @@ func TestCompressor_UniqueFields(t *testing.T) {
 	t.Logf("Kept customers separate: %s", result)
 }
 
+func TestCompressor_HashGroupKeys(t *testing.T) {
+	input := `[
+		{"ts": 1000, "bytes": 100, "server": "web1", "customer_id": "cust1"},
+		{"ts": 1010, "bytes": 200, "server": "web1", "customer_id": "cust1"},
+		{"ts": 1000, "bytes": 300, "server": "web1", "customer_id": "cust2"},
+		{"ts": 1000, "bytes": 400, "server": "web2"},
+		{"ts": 1010, "bytes": 500, "customer_id": "cust1"},
+		{"ts": 1090, "bytes": 600, "server": "web1", "customer_id": "cust1"}
+	]`
+
+	compress := func(hash bool) []byte {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"bytes"},
+			GroupByFields:     []string{"server"},
+			UniqueFields:      []string{"customer_id"},
+			AggregationMethod: "sum",
+			TimeWindow:        60 * time.Second,
+			SortForInsert:     true,
+			HashGroupKeys:     hash,
+		})
+		result, err := c.CompressJSON([]byte(input))
+		require.NoError(t, err)
+		return result
+	}
+
+	plain, hashed := compress(false), compress(true)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(hashed, &output))
+	require.Len(t, output, 5)
+	require.JSONEq(t, string(plain), string(hashed))
+}
+
+func TestCompressor_TenantField(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes"},
+		GroupByFields:     []string{"host"},
+		TenantField:       "tenant",
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		SortForInsert:     true,
+	}
+
+	c := NewCompressor(config)
+
+	// Both tenants report the same host; the last record has no tenant
+	input := `[
+		{"ts": 1000, "bytes": 100, "host": "web1", "tenant": "acme"},
+		{"ts": 1010, "bytes": 200, "host": "web1", "tenant": "acme"},
+		{"ts": 1000, "bytes": 300, "host": "web1", "tenant": "globex"},
+		{"ts": 1010, "bytes": 400, "host": "web1"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	totals := make(map[interface{}]interface{})
+	for _, row := range output {
+		require.Equal(t, "web1", row["host"])
+		totals[row["tenant"]] = row["bytes"]
+	}
+	require.Equal(t, map[interface{}]interface{}{
+		"":       float64(400),
+		"acme":   float64(300),
+		"globex": float64(300),
+	}, totals)
+}
+
+func TestCompressor_OutputAsObject(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host", "dc"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		OutputAsObject:    true,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "value": 1, "host": "web1", "dc": "eu"},
+		{"ts": 1010, "value": 2, "host": "web1", "dc": "eu"},
+		{"ts": 1000, "value": 5, "host": "web2", "dc": "us"},
+		{"ts": 1030, "value": 7, "host": "web1", "dc": "eu"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	require.Equal(t, float64(3), output["dc=eu;host=web1;window=960"]["value"])
+	require.Equal(t, float64(5), output["dc=us;host=web2;window=960"]["value"])
+	require.Equal(t, float64(7), output["dc=eu;host=web1;window=1020"]["value"])
+	require.Equal(t, "web1", output["dc=eu;host=web1;window=1020"]["host"])
+}
+
 func TestCompressor_TimeWindows(t *testing.T) {
 	config := &Config{
 		TimestampField:    "ts",
@@ -250,3 +359,1635 @@ func BenchmarkCompressor_1000Points(b *testing.B) {
 		_, _ = c.CompressJSON(data)
 	}
 }
+
+func TestCompressor_CountWithoutValueFields(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "count",
+		TimeWindow:        60 * time.Second,
+	}
+
+	c := NewCompressor(config)
+	require.Empty(t, c.config.ValueFields)
+
+	// Events carry no value field at all
+	input := `[
+		{"ts": 1000, "host": "web1"},
+		{"ts": 1005, "host": "web1"},
+		{"ts": 1010, "host": "web1", "value": 42},
+		{"ts": 1000, "host": "web2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	for _, row := range output {
+		switch row["host"] {
+		case "web1":
+			require.Equal(t, float64(3), row["count"])
+		case "web2":
+			require.Equal(t, float64(1), row["count"])
+		default:
+			t.Errorf("unexpected host %v", row["host"])
+		}
+	}
+}
+
+func TestCompressor_EmitDataBounds(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		EmitDataBounds:    true,
+	}
+
+	c := NewCompressor(config)
+
+	// The window covers 960-1019 but the data only spans 1000-1015
+	input := `[
+		{"ts": 1005, "value": 1},
+		{"ts": 1000, "value": 1},
+		{"ts": 1015, "value": 1}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(1000), output[0]["data_first"])
+	require.Equal(t, float64(1015), output[0]["data_last"])
+}
+
+func TestCompressor_EmitCount(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		EmitCount:         true,
+		SortForInsert:     true,
+	}
+
+	c := NewCompressor(config)
+	require.NoError(t, c.Err())
+
+	input := `[
+		{"ts": 1000, "bytes": 10, "host": "web1"},
+		{"ts": 1005, "bytes": 20, "host": "web1"},
+		{"ts": 1010, "bytes": 30, "host": "web1"},
+		{"ts": 1000, "bytes": 40, "host": "web2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+	require.Equal(t, float64(3), output[0]["count"])
+	require.Equal(t, float64(1), output[1]["count"])
+
+	config.CountField = "points"
+	result, err = NewCompressor(config).CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Equal(t, float64(3), output[0]["points"])
+
+	// A count field naming a value field fails at construction and on every call
+	config.CountField = "bytes"
+	c = NewCompressor(config)
+	require.ErrorContains(t, c.Err(), `count field "bytes" collides with a value field`)
+	_, err = c.CompressJSON([]byte(input))
+	require.ErrorIs(t, err, c.Err())
+}
+
+func TestCompressor_PassthroughFields(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes"},
+		GroupByFields:     []string{"host"},
+		PassthroughFields: []string{"region", "meta"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		SortForInsert:     true,
+	}
+
+	// web1 disagrees on region and only its second record has meta
+	input := `[
+		{"ts": 1000, "bytes": 10, "host": "web1", "region": "eu"},
+		{"ts": 1005, "bytes": 20, "host": "web1", "region": "us", "meta": {"rack": 7}},
+		{"ts": 1010, "bytes": 30, "host": "web1", "region": "ap"},
+		{"ts": 1000, "bytes": 40, "host": "web2"}
+	]`
+
+	for _, spill := range []int{0, 1} {
+		config.SpillThresholdBytes = spill
+		result, err := NewCompressor(config).CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		require.Len(t, output, 2)
+		require.Equal(t, float64(60), output[0]["bytes"])
+		require.Equal(t, "eu", output[0]["region"])
+		require.Equal(t, map[string]interface{}{"rack": float64(7)}, output[0]["meta"])
+		require.NotContains(t, output[1], "region")
+		require.NotContains(t, output[1], "meta")
+	}
+}
+
+func TestCompressor_EmitRate(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		EmitRate:          true,
+	}
+
+	c := NewCompressor(config)
+
+	// web1: 5 samples spanning 970-1010 (40s), web2: a single sample
+	input := `[
+		{"ts": 970, "value": 1, "host": "web1"},
+		{"ts": 980, "value": 1, "host": "web1"},
+		{"ts": 990, "value": 1, "host": "web1"},
+		{"ts": 1000, "value": 1, "host": "web1"},
+		{"ts": 1010, "value": 1, "host": "web1"},
+		{"ts": 1000, "value": 1, "host": "web2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	for _, row := range output {
+		switch row["host"] {
+		case "web1":
+			require.Equal(t, float64(40), row["span_seconds"])
+			require.InDelta(t, 0.125, row["sample_rate"], 1e-9) // 5 samples / 40s
+		case "web2":
+			require.Equal(t, float64(0), row["span_seconds"])
+			require.Equal(t, float64(0), row["sample_rate"])
+		default:
+			t.Errorf("unexpected host %v", row["host"])
+		}
+	}
+}
+
+func TestCompressor_TimestampFunc(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		TimestampFunc: func(record gjson.Result) (int64, bool) {
+			// Composite "host-<epoch>" identifier
+			id := record.Get("id").String()
+			idx := strings.LastIndexByte(id, '-')
+			if idx < 0 {
+				return 0, false
+			}
+			ts, err := strconv.ParseInt(id[idx+1:], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return ts, true
+		},
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"id": "host-1700000000", "value": 1},
+		{"id": "host-1700000010", "value": 2},
+		{"id": "host-1700000060", "value": 4},
+		{"id": "broken", "value": 100}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	sums := make(map[float64]float64)
+	for _, row := range output {
+		ts := row["ts"].(float64)
+		sums[float64(int64(ts)/60*60)] = row["value"].(float64)
+	}
+	require.Equal(t, map[float64]float64{1699999980: 3, 1700000040: 4}, sums)
+}
+
+func TestCompressor_WindowReference(t *testing.T) {
+	input := `[
+		{"ts": 1000, "value": 1},
+		{"ts": 1010, "value": 2},
+		{"ts": 1030, "value": 4}
+	]`
+
+	windows := func(reference int64) map[int64]float64 {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"value"},
+			AggregationMethod: "sum",
+			TimeWindow:        60 * time.Second,
+			WindowReference:   reference,
+		})
+
+		groups, err := c.collectGroups([]byte(input))
+		require.NoError(t, err)
+
+		sums := make(map[int64]float64)
+		for _, group := range groups {
+			sums[group.Window] = c.groupValue(group)
+		}
+		return sums
+	}
+
+	// Epoch-aligned: 960-1019 and 1020-1079
+	require.Equal(t, map[int64]float64{960: 3, 1020: 4}, windows(0))
+
+	// Aligned to 1005: 945-1004, 1005-1064
+	require.Equal(t, map[int64]float64{945: 1, 1005: 6}, windows(1005))
+}
+
+func TestCompressor_WindowOffset(t *testing.T) {
+	const day = 86400
+
+	// 08:00 belongs to the previous business day, 10:00 and 08:00 the next day to the same one
+	input := fmt.Sprintf(`[
+		{"ts": %d, "value": 1},
+		{"ts": %d, "value": 2},
+		{"ts": %d, "value": 4}
+	]`, 10*day+8*3600, 10*day+10*3600, 11*day+8*3600)
+
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "first",
+		TimeWindow:        24 * time.Hour,
+		WindowOffset:      9 * time.Hour,
+		OutputAsObject:    true,
+	})
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	previous := output[fmt.Sprintf("window=%d", 9*day+9*3600)]
+	require.Equal(t, float64(1), previous["value"])
+	require.Equal(t, float64(10*day+8*3600), previous["ts"])
+
+	current := output[fmt.Sprintf("window=%d", 10*day+9*3600)]
+	require.Equal(t, float64(2), current["value"])
+	require.Equal(t, float64(10*day+10*3600), current["ts"])
+
+	// Zero offset keeps epoch alignment
+	c = NewCompressor(&Config{TimestampField: "ts", TimeWindow: 24 * time.Hour})
+	require.Equal(t, int64(10*day), c.windowStart(10*day+10*3600, day))
+}
+
+func TestCompressor_SelfTest(t *testing.T) {
+	require.NoError(t, NewCompressor(nil).SelfTest())
+
+	require.NoError(t, NewCompressor(&Config{
+		TimestampField:    "@ts",
+		ValueFields:       []string{"cpu", "mem"},
+		AggregationMethod: "avg",
+	}).SelfTest())
+
+	require.NoError(t, NewCompressor(&Config{AggregationMethod: "count", ValueFields: []string{}}).SelfTest())
+
+	// Valid configs that split, drop or reshape the synthetic rows
+	for name, modify := range map[string]func(*Config){
+		"field windows": func(c *Config) {
+			c.ValueFields = []string{"cpu", "mem"}
+			c.FieldWindows = map[string]time.Duration{"cpu": time.Minute}
+		},
+		"discard first": func(c *Config) { c.DiscardFirstWindow = true },
+		"min samples":   func(c *Config) { c.MinSamples = 3 },
+		"ndjson output": func(c *Config) { c.OutputFormat = "ndjson" },
+		"ndjson empty":  func(c *Config) { c.OutputFormat = "ndjson"; c.MinSamples = 3 },
+		"ndjson input":  func(c *Config) { c.InputFormat = "ndjson" },
+		"envelope":      func(c *Config) { c.EmitEnvelope = true },
+		"object output": func(c *Config) { c.OutputAsObject = true },
+		"schema header": func(c *Config) { c.EmitSchemaHeader = true },
+	} {
+		config := DefaultConfig()
+		modify(config)
+		require.NoError(t, NewCompressor(config).SelfTest(), name)
+	}
+}
+
+func TestCompressor_FieldMethods(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem", "bytes"},
+		AggregationMethod: "sum",
+		FieldMethods:      map[string]string{"cpu": "max", "mem": "avg"},
+		TimeWindow:        60 * time.Second,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "cpu": 40, "mem": 10, "bytes": 100},
+		{"ts": 1010, "cpu": 90, "mem": 20, "bytes": 200},
+		{"ts": 1015, "cpu": 60, "mem": 60, "bytes": 300}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(90), output[0]["cpu"])
+	require.Equal(t, float64(30), output[0]["mem"])
+	require.Equal(t, float64(600), output[0]["bytes"]) // falls back to AggregationMethod
+}
+
+func TestCompressor_MissingValueFieldOmitted(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "min",
+		TimeWindow:        60 * time.Second,
+	})
+
+	result, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "cpu": 5, "mem": 10, "host": "web1"},
+		{"ts": 1000, "cpu": 7, "host": "db1"}
+	]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"ts": 1000, "cpu": 7, "host": "db1"},
+		{"ts": 1000, "cpu": 5, "mem": 10, "host": "web1"}
+	]`, string(result))
+}
+
+func TestCompressor_OutputFieldNames(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem"},
+		AggregationMethod: "sum",
+		FieldMethods:      map[string]string{"cpu": "avg"},
+		OutputFieldNames:  map[string]string{"cpu": "cpu_avg"},
+		TimeWindow:        60 * time.Second,
+	}
+
+	c := NewCompressor(config)
+	require.NoError(t, c.Err())
+
+	result, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "cpu": 40, "mem": 10},
+		{"ts": 1010, "cpu": 60, "mem": 20}
+	]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"ts": 1005, "cpu_avg": 50, "mem": 30}]`, string(result))
+
+	// Two fields sharing an output name fail at construction
+	config.OutputFieldNames = map[string]string{"cpu": "usage", "mem": "usage"}
+	c = NewCompressor(config)
+	require.ErrorContains(t, c.Err(), `are both output as "usage"`)
+	_, err = c.CompressJSON([]byte(`[]`))
+	require.Error(t, err)
+
+	config.OutputFieldNames = map[string]string{"cpu": "mem"}
+	require.ErrorContains(t, NewCompressor(config).Err(), `value fields "cpu" and "mem" are both output as "mem"`)
+
+	config.OutputFieldNames = map[string]string{"mem": "ts"}
+	require.ErrorContains(t, NewCompressor(config).Err(), "timestamp field")
+}
+
+func TestCompressor_FieldScales(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"kb", "cpu"},
+		AggregationMethod: "sum",
+		FieldMethods:      map[string]string{"cpu": "max"},
+		FieldScales:       map[string]float64{"kb": 1024, "missing": 2},
+		TimeWindow:        60 * time.Second,
+	})
+
+	result, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "kb": 1, "cpu": 40},
+		{"ts": 1010, "kb": 2.5, "cpu": 90}
+	]`))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(3584), output[0]["kb"])
+	require.Equal(t, float64(90), output[0]["cpu"]) // unscaled
+}
+
+func TestCompressor_SumDuplicateKeys(t *testing.T) {
+	input := `[
+		{"ts": 1000, "bytes": 100, "bytes": 50},
+		{"ts": 1010, "bytes": 10}
+	]`
+
+	compress := func(sumDuplicates bool) float64 {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"bytes"},
+			AggregationMethod: "sum",
+			TimeWindow:        60 * time.Second,
+			SumDuplicateKeys:  sumDuplicates,
+		})
+		result, err := c.CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		require.Len(t, output, 1)
+		return output[0]["bytes"].(float64)
+	}
+
+	require.Equal(t, float64(110), compress(false)) // only the first occurrence is read
+	require.Equal(t, float64(160), compress(true))
+}
+
+func TestCompressor_MethodByTag(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"metric", "metric_type"},
+		AggregationMethod: "max",
+		TimeWindow:        60 * time.Second,
+		MethodTagField:    "metric_type",
+		MethodByTag: map[string]string{
+			"counter": "sum",
+			"gauge":   "avg",
+		},
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "value": 10, "metric": "requests", "metric_type": "counter"},
+		{"ts": 1010, "value": 20, "metric": "requests", "metric_type": "counter"},
+		{"ts": 1000, "value": 40, "metric": "cpu", "metric_type": "gauge"},
+		{"ts": 1010, "value": 60, "metric": "cpu", "metric_type": "gauge"},
+		{"ts": 1000, "value": 1, "metric": "temp", "metric_type": "other"},
+		{"ts": 1010, "value": 7, "metric": "temp", "metric_type": "other"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	values := make(map[string]float64)
+	for _, row := range output {
+		values[row["metric"].(string)] = row["value"].(float64)
+	}
+
+	require.Equal(t, float64(30), values["requests"]) // counter: sum
+	require.Equal(t, float64(50), values["cpu"])      // gauge: avg
+	require.Equal(t, float64(7), values["temp"])      // fallback: max
+}
+
+func TestCompressor_WindowField(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"tenant"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		WindowField:       "rollup",
+	}
+
+	c := NewCompressor(config)
+
+	// tenant a rolls up over 300s, tenant b uses the default 60s,
+	// tenant c carries an invalid rollup and falls back to 60s
+	input := `[
+		{"ts": 900, "value": 1, "tenant": "a", "rollup": 300},
+		{"ts": 1000, "value": 2, "tenant": "a", "rollup": 300},
+		{"ts": 1190, "value": 4, "tenant": "a", "rollup": 300},
+		{"ts": 900, "value": 1, "tenant": "b"},
+		{"ts": 1000, "value": 2, "tenant": "b"},
+		{"ts": 1190, "value": 4, "tenant": "b"},
+		{"ts": 900, "value": 1, "tenant": "c", "rollup": -5},
+		{"ts": 1000, "value": 2, "tenant": "c", "rollup": "soon"}
+	]`
+
+	groups, err := c.collectGroups([]byte(input))
+	require.NoError(t, err)
+
+	windows := make(map[string][]int64)
+	for _, group := range groups {
+		windows[group.Tags["tenant"]] = append(windows[group.Tags["tenant"]], group.Window)
+	}
+
+	require.ElementsMatch(t, []int64{900}, windows["a"])
+	require.ElementsMatch(t, []int64{900, 960, 1140}, windows["b"])
+	require.ElementsMatch(t, []int64{900, 960}, windows["c"])
+}
+
+func TestCompressor_CollectFields(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu"},
+		GroupByFields:     []string{"host"},
+		CollectFields:     []string{"pod"},
+		AggregationMethod: "avg",
+		TimeWindow:        60 * time.Second,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "cpu": 10, "host": "node1", "pod": "api-1"},
+		{"ts": 1005, "cpu": 20, "host": "node1", "pod": "api-2"},
+		{"ts": 1010, "cpu": 30, "host": "node1", "pod": "api-1"},
+		{"ts": 1000, "cpu": 50, "host": "node2", "pod": "db-1"},
+		{"ts": 1005, "cpu": 70, "host": "node2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	for _, row := range output {
+		switch row["host"] {
+		case "node1":
+			require.Equal(t, []interface{}{"api-1", "api-2"}, row["pod"])
+		case "node2":
+			require.Equal(t, []interface{}{"db-1"}, row["pod"])
+		default:
+			t.Errorf("unexpected host %v", row["host"])
+		}
+	}
+}
+
+func TestCompressor_GroupByMissingPolicy(t *testing.T) {
+	// web1 has a host tag, the other two records lack it
+	input := `[
+		{"ts": 1000, "value": 1, "host": "web1"},
+		{"ts": 1005, "value": 2},
+		{"ts": 1010, "value": 4, "dc": "eu"}
+	]`
+
+	tests := []struct {
+		policy   string
+		expected map[interface{}]float64 // host tag -> sum
+	}{
+		{"", map[interface{}]float64{"web1": 1, nil: 6}},
+		{"skip", map[interface{}]float64{"web1": 1}},
+		{"empty", map[interface{}]float64{"web1": 1, "": 6}},
+		{"separate", map[interface{}]float64{"web1": 1, "<missing>": 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run("policy="+tt.policy, func(t *testing.T) {
+			c := NewCompressor(&Config{
+				TimestampField:       "ts",
+				ValueFields:          []string{"value"},
+				GroupByFields:        []string{"host"},
+				GroupByMissingPolicy: tt.policy,
+				AggregationMethod:    "sum",
+				TimeWindow:           60 * time.Second,
+			})
+
+			result, err := c.CompressJSON([]byte(input))
+			require.NoError(t, err)
+
+			var output []map[string]interface{}
+			require.NoError(t, json.Unmarshal(result, &output))
+
+			sums := make(map[interface{}]float64)
+			for _, row := range output {
+				sums[row["host"]] = row["value"].(float64)
+			}
+			require.Equal(t, tt.expected, sums)
+		})
+	}
+}
+
+func TestCompressor_SubSampleInterval(t *testing.T) {
+	config := &Config{
+		TimestampField:    "t",
+		ValueFields:       []string{"v"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Second,
+		SubSampleInterval: time.Second,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"t": 1000, "v": [10, 20, 30]},
+		{"t": 1001, "v": 5}
+	]`
+
+	groups, err := c.collectGroups([]byte(input))
+	require.NoError(t, err)
+	require.Len(t, groups, 3)
+
+	sums := make(map[int64]float64)
+	for _, group := range groups {
+		sums[group.Window] = c.groupValue(group)
+	}
+
+	require.Equal(t, map[int64]float64{1000: 10, 1001: 25, 1002: 30}, sums)
+}
+
+func TestCompressor_Clamp(t *testing.T) {
+	minVal, maxVal := 0.0, 100.0
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		ClampMin:          &minVal,
+		ClampMax:          &maxVal,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "value": 80, "host": "high"},
+		{"ts": 1010, "value": 70, "host": "high"},
+		{"ts": 1000, "value": -5, "host": "low"},
+		{"ts": 1000, "value": 42, "host": "ok"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	values := make(map[string]float64)
+	for _, row := range output {
+		values[row["host"].(string)] = row["value"].(float64)
+	}
+
+	require.Equal(t, map[string]float64{"high": 100, "low": 0, "ok": 42}, values)
+}
+
+func TestCompressor_CountTimestampOnly(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		AggregationMethod: "count",
+		TimeWindow:        60 * time.Second,
+	}
+
+	c := NewCompressor(config)
+
+	// Pure events: nothing but a timestamp
+	input := `[
+		{"ts": 960}, {"ts": 970}, {"ts": 1019},
+		{"ts": 1020}, {"ts": 1079},
+		{"ts": 1200}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	counts := make(map[int64]float64)
+	for _, row := range output {
+		require.Len(t, row, 2, "row should only hold timestamp and count: %v", row)
+		ts := int64(row["ts"].(float64))
+		counts[ts/60*60] = row["count"].(float64)
+	}
+
+	require.Equal(t, map[int64]float64{960: 3, 1020: 2, 1200: 1}, counts)
+}
+
+func TestCompressor_NestedOutput(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem"},
+		GroupByFields:     []string{"host"},
+		UniqueFields:      []string{"region"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		NestedOutput:      true,
+	}
+
+	c := NewCompressor(config)
+
+	input := `[
+		{"ts": 1000, "cpu": 10, "mem": 20, "host": "web1", "region": "eu"},
+		{"ts": 1010, "cpu": 30, "mem": 40, "host": "web1", "region": "eu"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+
+	row := output[0]
+	require.Len(t, row, 3)
+	require.Equal(t, float64(1005), row["ts"])
+	require.Equal(t, map[string]interface{}{"host": "web1", "region": "eu"}, row["tags"])
+	require.Equal(t, map[string]interface{}{"cpu": float64(40), "mem": float64(60)}, row["values"])
+}
+
+func TestCompressor_FirstLastChronological(t *testing.T) {
+	// Records arrive out of order
+	input := `[
+		{"ts": 1010, "value": 2},
+		{"ts": 1000, "value": 1},
+		{"ts": 1015, "value": 3},
+		{"ts": 1005, "value": 9}
+	]`
+
+	for method, expected := range map[string]float64{"first": 1, "last": 3} {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"value"},
+			AggregationMethod: method,
+			TimeWindow:        60 * time.Second,
+		})
+
+		result, err := c.CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		require.Len(t, output, 1)
+		require.Equal(t, expected, output[0]["value"], method)
+	}
+}
+
+func TestCompressor_TieBreakField(t *testing.T) {
+	// Two records share the earliest and two the latest timestamp; seq decides
+	input := `[
+		{"ts": 1000, "value": 20, "seq": 2},
+		{"ts": 1000, "value": 10, "seq": 1},
+		{"ts": 1010, "value": 5, "seq": 3},
+		{"ts": 1015, "value": 40, "seq": 5},
+		{"ts": 1015, "value": 30, "seq": 4}
+	]`
+
+	for method, expected := range map[string]float64{"first": 10, "last": 40} {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"value"},
+			AggregationMethod: method,
+			TimeWindow:        60 * time.Second,
+			TieBreakField:     "seq",
+		})
+
+		result, err := c.CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		require.Len(t, output, 1)
+		require.Equal(t, expected, output[0]["value"], method)
+	}
+}
+
+func TestCompressor_ValueOrderField(t *testing.T) {
+	// Input order and timestamps disagree with the sequence numbers
+	input := `[
+		{"ts": 1000, "value": 10, "seq": 3},
+		{"ts": 1005, "value": 20, "seq": 1},
+		{"ts": 1010, "value": 30, "seq": 2}
+	]`
+
+	tests := []struct {
+		orderField string
+		expected   float64
+	}{
+		{"", 10},    // chronological first
+		{"seq", 20}, // lowest sequence number
+	}
+
+	for _, tt := range tests {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"value"},
+			AggregationMethod: "first",
+			TimeWindow:        60 * time.Second,
+			ValueOrderField:   tt.orderField,
+		})
+
+		for run := 0; run < 3; run++ {
+			result, err := c.CompressJSON([]byte(input))
+			require.NoError(t, err)
+
+			var output []map[string]interface{}
+			require.NoError(t, json.Unmarshal(result, &output))
+			require.Len(t, output, 1)
+			require.Equal(t, tt.expected, output[0]["value"], "order field %q", tt.orderField)
+		}
+	}
+}
+
+func TestCompressJSON_RFC3339Offset(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	// 15:04:05+02:00 is 13:04:05Z; both land in the 13:04 UTC window
+	input := `[
+		{"ts": "2024-01-02T15:04:05+02:00", "value": 1},
+		{"ts": "2024-01-02T13:04:30Z", "value": 2}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(3), output[0]["value"])
+
+	utc := time.Date(2024, 1, 2, 13, 4, 5, 0, time.UTC).Unix()
+	require.Equal(t, float64(utc+12), output[0]["ts"]) // midpoint of :05 and :30
+}
+
+func TestCompressJSON_TimestampFormat(t *testing.T) {
+	compress := func(format, input string) []map[string]interface{} {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"value"},
+			AggregationMethod: "first",
+			TimeWindow:        time.Minute,
+			TimestampFormat:   format,
+		})
+		require.NoError(t, c.SelfTest())
+
+		result, err := c.CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		return output
+	}
+
+	// Numbers are not RFC 3339 timestamps and are skipped
+	output := compress("rfc3339", `[
+		{"ts": "2024-01-02T15:04:05Z", "value": 1},
+		{"ts": "2024-01-02T15:04:30Z", "value": 2},
+		{"ts": "not a time", "value": 4},
+		{"ts": 1704207845, "value": 8}
+	]`)
+	require.Len(t, output, 1)
+	require.Equal(t, "2024-01-02T15:04:05Z", output[0]["ts"])
+	require.Equal(t, float64(1), output[0]["value"])
+
+	output = compress("unixms", `[
+		{"ts": 1704207845000, "value": 1},
+		{"ts": 1704207870500, "value": 2},
+		{"ts": "2024-01-02T15:04:05Z", "value": 4}
+	]`)
+	require.Len(t, output, 1)
+	require.Equal(t, float64(1704207845000), output[0]["ts"])
+	require.Equal(t, float64(1), output[0]["value"])
+}
+
+func TestCompressJSON_TimestampAsValue(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"ts", "value"},
+		AggregationMethod: "avg",
+		TimeWindow:        time.Minute,
+	})
+
+	input := `[
+		{"ts": 1000, "value": 1},
+		{"ts": 1010, "value": 2},
+		{"ts": 1018, "value": 3}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(1009), output[0]["ts"])         // row timestamp, midpoint of 1000 and 1018
+	require.Equal(t, float64(3028)/3, output[0]["ts_value"]) // average of the timestamps
+	require.Equal(t, float64(2), output[0]["value"])
+}
+
+func TestCompressJSON_TimestampUnit(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		TimestampUnit:     "ms",
+		EmitRate:          true,
+		OutputAsObject:    true,
+	})
+
+	// 15:04:05.000 and 15:04:30.500 share the 15:04 window, 15:05:05.000 starts the next
+	input := `[
+		{"ts": 1704207845000, "value": 1},
+		{"ts": 1704207870500, "value": 2},
+		{"ts": 1704207905000, "value": 4}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	first := output["window=1704207840000"]
+	require.Equal(t, float64(3), first["value"])
+	require.Equal(t, float64(1704207857750), first["ts"]) // midpoint, still in milliseconds
+	require.Equal(t, 25.5, first["span_seconds"])
+
+	second := output["window=1704207900000"]
+	require.Equal(t, float64(4), second["value"])
+	require.Equal(t, float64(1704207905000), second["ts"])
+}
+
+func TestCompressJSON_TimestampUnitNanoseconds(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "first",
+		TimeWindow:        time.Second,
+		TimestampUnit:     "ns",
+		TimestampFormat:   "rfc3339",
+	})
+
+	input := `[
+		{"ts": "2024-01-02T15:04:05.250Z", "value": 1},
+		{"ts": "2024-01-02T15:04:05.750Z", "value": 2},
+		{"ts": "2024-01-02T15:04:06.100Z", "value": 4}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	emitted := make(map[interface{}]interface{})
+	for _, row := range output {
+		emitted[row["ts"]] = row["value"]
+	}
+	require.Equal(t, map[interface{}]interface{}{
+		"2024-01-02T15:04:05.25Z": float64(1),
+		"2024-01-02T15:04:06.1Z":  float64(4),
+	}, emitted)
+}
+
+func TestCompressJSON_DiscardFirstWindow(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.DiscardFirstWindow = true
+	config.SortForInsert = true
+	c := NewCompressor(config)
+
+	// web1 starts in the 960 window, web2 only in the 1020 window
+	input := `[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1030, "value": 2, "host": "web1"},
+		{"timestamp": 1090, "value": 4, "host": "web1"},
+		{"timestamp": 1030, "value": 8, "host": "web2"},
+		{"timestamp": 1090, "value": 16, "host": "web2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	kept := make(map[string][]float64)
+	for _, row := range output {
+		host := row["host"].(string)
+		kept[host] = append(kept[host], row["value"].(float64))
+	}
+	require.Equal(t, map[string][]float64{"web1": {2, 4}, "web2": {16}}, kept)
+}
+
+func TestCompressJSON_WindowMergeGap(t *testing.T) {
+	config := DefaultConfig()
+	config.ValueFields = []string{"value", "cpu"}
+	config.FieldMethods = map[string]string{"cpu": "max"}
+	config.WindowMergeGap = 5 * time.Second
+	config.SortForInsert = true
+	c := NewCompressor(config)
+
+	// 1019 and 1021 straddle the 1020 boundary; 1100 is far from both
+	input := `[
+		{"timestamp": 1015, "value": 1, "cpu": 10},
+		{"timestamp": 1019, "value": 2, "cpu": 30},
+		{"timestamp": 1021, "value": 4, "cpu": 20},
+		{"timestamp": 1100, "value": 8, "cpu": 5}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	require.Equal(t, float64(1018), output[0]["timestamp"]) // Midpoint of 1015 and 1021
+	require.Equal(t, float64(7), output[0]["value"])
+	require.Equal(t, float64(30), output[0]["cpu"])
+	require.Equal(t, float64(8), output[1]["value"])
+
+	// Without the gap the boundary splits the burst
+	config.WindowMergeGap = 0
+	result, err = NewCompressor(config).CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+}
+
+func TestCompressJSON_NDJSON(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.InputFormat = "ndjson"
+	config.SortForInsert = true
+
+	input := "{\"timestamp\": 1000, \"value\": 1, \"host\": \"web1\"}\n" +
+		"\n" +
+		"{\"timestamp\": 1010, \"value\": 2, \"host\": \"web1\"}\r\n" +
+		"{\"timestamp\": 1020, \"value\": \n" +
+		"{\"timestamp\": 1005, \"value\": 4, \"host\": \"web2\"}"
+
+	result, stats, err := NewCompressor(config).CompressJSONStats([]byte(input))
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Records)
+	require.Equal(t, 1, stats.Skipped) // The malformed line
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+	require.Equal(t, float64(3), output[0]["value"])
+	require.Equal(t, float64(4), output[1]["value"])
+
+	// The default array format rejects NDJSON
+	config.InputFormat = ""
+	_, err = NewCompressor(config).CompressJSON([]byte(input))
+	require.ErrorContains(t, err, "expected JSON array")
+}
+
+func TestCompressJSON_NDJSONOutput(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.OutputFormat = "ndjson"
+
+	input := []byte(`[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1010, "value": 2, "host": "web1"},
+		{"timestamp": 1005, "value": 4, "host": "web2"}
+	]`)
+
+	c := NewCompressor(config)
+	result, err := c.CompressJSON(input)
+	require.NoError(t, err)
+	require.Equal(t, "{\"host\":\"web1\",\"timestamp\":1005,\"value\":3}\n"+
+		"{\"host\":\"web2\",\"timestamp\":1005,\"value\":4}\n", string(result))
+	require.Positive(t, c.GetCompressionRatio(input, result))
+
+	// No rows produce no lines
+	result, err = c.CompressJSON([]byte(`[]`))
+	require.NoError(t, err)
+	require.Empty(t, result)
+
+	// Only the last pipeline stage writes NDJSON
+	config.Pipeline = []Stage{{Name: "deadband"}, {Name: "aggregate"}}
+	result, err = NewCompressor(config).CompressJSON(input)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(result), "\n"))
+}
+
+func TestCompressJSON_DeterministicOrder(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.UniqueFields = []string{"region"}
+
+	input := []byte(`[
+		{"timestamp": 1090, "value": 1, "host": "web3", "region": "us"},
+		{"timestamp": 1000, "value": 2, "host": "web2", "region": "eu"},
+		{"timestamp": 1000, "value": 3, "host": "web1", "region": "eu"},
+		{"timestamp": 1000, "value": 4, "host": "web1", "region": "us"},
+		{"timestamp": 1030, "value": 5, "host": "web2", "region": "eu"},
+		{"timestamp": 1150, "value": 6, "host": "web1", "region": "eu"}
+	]`)
+
+	first, err := NewCompressor(config).CompressJSON(input)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		again, err := NewCompressor(config).CompressJSON(input)
+		require.NoError(t, err)
+		require.Equal(t, first, again)
+	}
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(first, &output))
+
+	order := make([]float64, 0, len(output))
+	for _, row := range output {
+		order = append(order, row["value"].(float64))
+	}
+	// By timestamp, then group key (tags in GroupByFields/UniqueFields order)
+	require.Equal(t, []float64{3, 4, 2, 5, 1, 6}, order)
+}
+
+func TestCompressJSON_MinSamples(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.MinSamples = 2
+	c := NewCompressor(config)
+
+	input := `[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1010, "value": 2, "host": "web1"},
+		{"timestamp": 1000, "value": 5, "host": "web2"}
+	]`
+
+	result, stats, err := c.CompressJSONStats([]byte(input))
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Groups)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, "web1", output[0]["host"])
+	require.Equal(t, float64(3), output[0]["value"])
+}
+
+func TestCompressJSON_DebugSourceOffsets(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.Debug = true
+	c := NewCompressor(config)
+
+	first := `{"timestamp": 1000, "value": 1, "host": "web1"}`
+	other := `{"timestamp": 1000, "value": 5, "host": "web2"}`
+	last := `{"timestamp": 1010, "value": 2, "host": "web1"}`
+	input := "[" + first + ", " + other + ", " + last + "]"
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	for _, row := range output {
+		start, end := int(row["_src_start"].(float64)), int(row["_src_end"].(float64))
+		switch row["host"] {
+		case "web1":
+			require.Equal(t, strings.Index(input, first), start)
+			require.Equal(t, strings.Index(input, last)+len(last), end)
+		case "web2":
+			require.Equal(t, other, input[start:end])
+		}
+	}
+
+	// Offsets are omitted unless Debug is set
+	result, err = NewCompressor(nil).CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.NotContains(t, string(result), "_src_start")
+}
+
+func TestCompressJSON_CollectOverflow(t *testing.T) {
+	minTS := int64(900)
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.GroupByMissingPolicy = "skip"
+	config.MinTimestamp = &minTS
+	config.CollectOverflow = true
+	c := NewCompressor(config)
+
+	input := `[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"value": 10, "host": "web1"},
+		{"timestamp": 100, "value": 20, "host": "web1"},
+		{"timestamp": 1000, "value": 30},
+		{"timestamp": 1000, "host": "web1"},
+		"junk"
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	var overflow map[string]interface{}
+	for _, row := range output {
+		if row["_overflow"] == true {
+			overflow = row
+		}
+	}
+	require.NotNil(t, overflow)
+	require.Equal(t, float64(60), overflow["value"])
+
+	// Without CollectOverflow the records are dropped
+	config.CollectOverflow = false
+	result, err = NewCompressor(config).CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+}
+
+func TestCompressJSON_CollectOverflowTimestamp(t *testing.T) {
+	minTS := int64(1_700_000_000)
+	config := DefaultConfig()
+	config.TimestampFormat = "rfc3339"
+	config.MinTimestamp = &minTS
+	config.CollectOverflow = true
+	config.AggregationMethod = "first"
+
+	// The rejected record keeps its parsed timestamp instead of epoch 0
+	result, err := NewCompressor(config).CompressJSON([]byte(`[
+		{"timestamp": "2020-01-01T00:00:00Z", "value": 5}
+	]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"timestamp": "2020-01-01T00:00:00Z", "value": 5, "_overflow": true}]`, string(result))
+}
+
+func TestCompressJSON_FieldWindows(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "disk"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		FieldWindows:      map[string]time.Duration{"disk": 10 * time.Minute},
+	})
+
+	input := `[
+		{"ts": 1000, "cpu": 1, "disk": 10},
+		{"ts": 1100, "cpu": 2, "disk": 20}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	cpuTimestamps := make(map[float64]float64)
+	for _, row := range output {
+		if disk, ok := row["disk"]; ok {
+			// Both records fall in the 600-1200 disk window
+			require.NotContains(t, row, "cpu")
+			require.Equal(t, float64(30), disk)
+			require.Equal(t, float64(1050), row["ts"])
+			continue
+		}
+		cpuTimestamps[row["ts"].(float64)] = row["cpu"].(float64)
+	}
+	require.Equal(t, map[float64]float64{1000: 1, 1100: 2}, cpuTimestamps)
+}
+
+func TestCompressJSON_SortForInsert(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.SortForInsert = true
+	c := NewCompressor(config)
+
+	input := `[
+		{"timestamp": 1200, "value": 1, "host": "web2"},
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1100, "value": 1, "host": "web2"},
+		{"timestamp": 1200, "value": 1, "host": "web1"},
+		{"timestamp": 1000, "value": 1, "host": "web2"},
+		{"timestamp": 1100, "value": 1, "host": "web1"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 6)
+
+	order := make([]string, 0, len(output))
+	for _, row := range output {
+		order = append(order, fmt.Sprintf("%s@%v", row["host"], row["timestamp"]))
+	}
+	require.Equal(t, []string{
+		"web1@1000", "web1@1100", "web1@1200",
+		"web2@1000", "web2@1100", "web2@1200",
+	}, order)
+}
+
+func TestCompressJSON_MultiplicityField(t *testing.T) {
+	input := `[
+		{"timestamp": 1000, "value": 5, "n": 100},
+		{"timestamp": 1005, "value": 2, "n": 3},
+		{"timestamp": 1010, "value": 1}
+	]`
+
+	tests := []struct {
+		method   string
+		expected float64
+	}{
+		{"sum", 5*100 + 2*3 + 1},
+		{"count", 104},
+		{"avg", float64(5*100+2*3+1) / 104},
+		{"max", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AggregationMethod = tt.method
+			config.MultiplicityField = "n"
+
+			result, err := NewCompressor(config).CompressJSON([]byte(input))
+			require.NoError(t, err)
+
+			var output []map[string]interface{}
+			require.NoError(t, json.Unmarshal(result, &output))
+			require.Len(t, output, 1)
+			require.InDelta(t, tt.expected, output[0]["value"], 1e-9)
+		})
+	}
+}
+
+func TestCompressJSON_MultiplicityFieldUnweighted(t *testing.T) {
+	// Count-only mode counts records, not their multiplicity
+	config := DefaultConfig()
+	config.ValueFields = []string{}
+	config.AggregationMethod = "count"
+	config.MultiplicityField = "n"
+	require.ErrorContains(t, NewCompressor(config).Err(), "requires value fields")
+
+	// Slice-based methods aggregate each record once
+	for _, method := range []string{"median", "p95", "first", "last", "rate", "auto"} {
+		config = DefaultConfig()
+		config.AggregationMethod = method
+		config.MultiplicityField = "n"
+		require.ErrorContains(t, NewCompressor(config).Err(), "cannot weight", method)
+	}
+
+	config = DefaultConfig()
+	config.ValueFields = []string{"value", "other"}
+	config.FieldMethods = map[string]string{"other": "median"}
+	config.MultiplicityField = "n"
+	require.ErrorContains(t, NewCompressor(config).Err(), `cannot weight method "median"`)
+}
+
+func TestCompressJSON_ValueSubPath(t *testing.T) {
+	config := DefaultConfig()
+	config.ValueSubPath = "raw"
+	c := NewCompressor(config)
+
+	input := `[
+		{"timestamp": 1000, "value": 1},
+		{"timestamp": 1005, "value": {"raw": 10}},
+		{"timestamp": 1010, "value": {"raw": "n/a"}},
+		{"timestamp": 1015, "value": {"other": 100}}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(11), output[0]["value"])
+}
+
+func TestCompressJSON_EmitISOTimestamp(t *testing.T) {
+	config := DefaultConfig()
+	config.EmitISOTimestamp = true
+	input := []byte(`[{"timestamp": 1704207845, "value": 1}]`)
+
+	result, err := NewCompressor(config).CompressJSON(input)
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, "2024-01-02T15:04:05Z", output[0]["timestamp_iso"])
+
+	parsed, err := time.Parse(time.RFC3339, output[0]["timestamp_iso"].(string))
+	require.NoError(t, err)
+	require.Equal(t, output[0]["timestamp"], float64(parsed.Unix()))
+
+	// Same instant rendered in another zone
+	config.ISOLocation = time.FixedZone("UTC+2", 2*60*60)
+	result, err = NewCompressor(config).CompressJSON(input)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Equal(t, "2024-01-02T17:04:05+02:00", output[0]["timestamp_iso"])
+}
+
+func TestCompressJSON_StalenessGap(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.StalenessGap = 2 * time.Minute
+	config.SortForInsert = true
+	c := NewCompressor(config)
+
+	// web1 windows: 960, 1020, then 1320 after a 240s gap; web2 windows are contiguous
+	input := `[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1030, "value": 1, "host": "web1"},
+		{"timestamp": 1330, "value": 1, "host": "web1"},
+		{"timestamp": 1000, "value": 1, "host": "web2"},
+		{"timestamp": 1150, "value": 1, "host": "web2"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 5)
+
+	stale := make([]string, 0)
+	for _, row := range output {
+		if row["_stale_after_gap"] == true {
+			stale = append(stale, fmt.Sprintf("%s@%v", row["host"], row["timestamp"]))
+		}
+	}
+	require.Equal(t, []string{"web1@1330"}, stale)
+}
+
+func TestCompressJSON_StalenessGapSeries(t *testing.T) {
+	// The overflow group is not a window of the series
+	config := DefaultConfig()
+	config.CollectOverflow = true
+	config.StalenessGap = time.Hour
+
+	result, err := NewCompressor(config).CompressJSON([]byte(`[
+		{"value": 10},
+		{"timestamp": 100000, "value": 1}
+	]`))
+	require.NoError(t, err)
+	require.NotContains(t, string(result), "_stale_after_gap")
+
+	// FieldWindows fields are separate series: mem's hourly windows are contiguous
+	config = DefaultConfig()
+	config.ValueFields = []string{"cpu", "mem"}
+	config.FieldWindows = map[string]time.Duration{"mem": time.Hour}
+	config.StalenessGap = 2 * time.Minute
+
+	result, err = NewCompressor(config).CompressJSON([]byte(`[
+		{"timestamp": 1000, "cpu": 1, "mem": 1},
+		{"timestamp": 3650, "mem": 1}
+	]`))
+	require.NoError(t, err)
+	require.NotContains(t, string(result), "_stale_after_gap")
+}
+
+func TestCompressJSON_RowBuilder(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+	config.RowBuilder = func(g *Group, aggregated map[string]float64) map[string]interface{} {
+		return map[string]interface{}{
+			"time":   g.Window,
+			"series": map[string]interface{}{"name": g.Tags["host"], "total": aggregated["value"]},
+			"n":      g.Count,
+		}
+	}
+	c := NewCompressor(config)
+
+	input := `[
+		{"timestamp": 1000, "value": 1, "host": "web1"},
+		{"timestamp": 1010, "value": 2, "host": "web1"}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"time": 960, "series": {"name": "web1", "total": 3}, "n": 2}]`, string(result))
+}
+
+func TestCompressJSON_TimestampRound(t *testing.T) {
+	tests := []struct {
+		round    time.Duration
+		expected float64
+	}{
+		{0, 1037},
+		{10 * time.Second, 1040},
+		{100 * time.Second, 1000},
+		{time.Minute, 1020},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.round.String(), func(t *testing.T) {
+			config := DefaultConfig()
+			config.TimeWindow = 5 * time.Minute
+			config.TimestampRound = tt.round
+
+			// Midpoint of 1000 and 1075 is 1037
+			result, err := NewCompressor(config).CompressJSON([]byte(`[{"timestamp": 1000, "value": 1}, {"timestamp": 1075, "value": 2}]`))
+			require.NoError(t, err)
+
+			var output []map[string]interface{}
+			require.NoError(t, json.Unmarshal(result, &output))
+			require.Len(t, output, 1)
+			require.Equal(t, tt.expected, output[0]["timestamp"])
+		})
+	}
+}
+
+func TestCompressor_NonNegative(t *testing.T) {
+	config := DefaultConfig()
+	config.GroupByFields = []string{"host"}
+
+	// 0.3 - 0.1 - 0.2 sums to about -2.8e-17 in floating point
+	input := `[
+		{"timestamp": 1000, "value": 0.3, "host": "web1"},
+		{"timestamp": 1001, "value": -0.1, "host": "web1"},
+		{"timestamp": 1002, "value": -0.2, "host": "web1"},
+		{"timestamp": 1000, "value": 5, "host": "web2"}
+	]`
+
+	values := func() map[string]float64 {
+		result, err := NewCompressor(config).CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+
+		byHost := make(map[string]float64)
+		for _, row := range output {
+			byHost[row["host"].(string)] = row["value"].(float64)
+		}
+		return byHost
+	}
+
+	require.Less(t, values()["web1"], float64(0))
+
+	config.NonNegative = true
+	require.Equal(t, map[string]float64{"web1": 0, "web2": 5}, values())
+}
+
+func TestCompressJSON_RateDefaultSampleInterval(t *testing.T) {
+	config := DefaultConfig()
+	config.AggregationMethod = "rate"
+	config.GroupByFields = []string{"host"}
+
+	input := `[
+		{"timestamp": 1000, "value": 30, "host": "single"},
+		{"timestamp": 1000, "value": 10, "host": "multi"},
+		{"timestamp": 1010, "value": 30, "host": "multi"}
+	]`
+
+	rates := func() map[string]float64 {
+		result, err := NewCompressor(config).CompressJSON([]byte(input))
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+
+		byHost := make(map[string]float64)
+		for _, row := range output {
+			byHost[row["host"].(string)] = row["value"].(float64)
+		}
+		return byHost
+	}
+
+	// Without an interval a single point has no rate
+	require.Equal(t, map[string]float64{"single": 0, "multi": 4}, rates())
+
+	config.DefaultSampleInterval = 15 * time.Second
+	require.Equal(t, map[string]float64{"single": 2, "multi": 4}, rates())
+}
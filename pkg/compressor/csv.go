@@ -0,0 +1,89 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// CompressToCSV aggregates data like CompressJSON and emits the rows as CSV with a
+// header. The columns are the timestamp field, then every other non-value field of
+// any row (tags and extras such as "sample_rate") sorted by name, then the value
+// fields in config order. Fields a row lacks are left blank.
+func (c *Compressor) CompressToCSV(data []byte) ([]byte, error) {
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(groups))
+	for _, group := range c.orderedGroups(groups) {
+		rows = append(rows, c.buildRow(group))
+	}
+
+	valueColumns := make([]string, 0, len(c.valueKeys()))
+	isValue := make(map[string]bool)
+	for _, key := range c.valueKeys() {
+		column := c.outputField(key)
+		valueColumns = append(valueColumns, column)
+		isValue[column] = true
+	}
+
+	seen := make(map[string]bool)
+	tagColumns := make([]string, 0)
+	for _, row := range rows {
+		for name := range row {
+			if !seen[name] && !isValue[name] && name != c.config.TimestampField {
+				seen[name] = true
+				tagColumns = append(tagColumns, name)
+			}
+		}
+	}
+	sort.Strings(tagColumns)
+
+	columns := append(append([]string{c.config.TimestampField}, tagColumns...), valueColumns...)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, name := range columns {
+			if record[i], err = csvValue(row[name]); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvValue formats an output value as a CSV field; nil is blank
+func csvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	}
+}
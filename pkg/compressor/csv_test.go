@@ -0,0 +1,36 @@
+package compressor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressToCSV(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "mem"},
+		GroupByFields:     []string{"host", "dc"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	// db1 has no dc and no mem, both left blank
+	input := `[
+		{"ts": 1000, "cpu": 1.5, "mem": 10, "dc": "eu, west", "host": "web1"},
+		{"ts": 1010, "cpu": 2, "mem": 20, "dc": "eu, west", "host": "web1"},
+		{"ts": 1100, "cpu": 4, "host": "db1"}
+	]`
+
+	result, err := c.CompressToCSV([]byte(input))
+	require.NoError(t, err)
+	require.Equal(t,
+		"ts,dc,host,cpu,mem\n"+
+			"1005,\"eu, west\",web1,3.5,30\n"+
+			"1100,,db1,4,\n",
+		string(result))
+
+	_, err = c.CompressToCSV([]byte(`{}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DeltaPayload is the lossless delta-encoded form produced by CompressJSONDelta.
+// Each series holds the rows of one tag set ordered by timestamp; the first element
+// of Timestamps and Values is the base, every following element is the difference
+// from the previous row.
+type DeltaPayload struct {
+	TimestampField string        `json:"timestamp_field"`
+	ValueField     string        `json:"value_field"`
+	Series         []DeltaSeries `json:"series"`
+}
+
+// DeltaSeries is a single delta-encoded series
+type DeltaSeries struct {
+	Tags       map[string]string `json:"tags,omitempty"`
+	Timestamps []int64           `json:"ts"`
+	Values     []int64           `json:"values"`
+}
+
+// CompressJSONDelta aggregates like CompressJSON and delta-encodes the integer
+// results per series. Only timestamp, value and tags are encoded.
+func (c *Compressor) CompressJSONDelta(data []byte) ([]byte, error) {
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return nil, err
+	}
+
+	type point struct {
+		ts    int64
+		value int64
+	}
+
+	if len(c.valueKeys()) > 1 {
+		return nil, fmt.Errorf("delta encoding supports a single value field, got %d", len(c.valueKeys()))
+	}
+
+	seriesTags := make(map[string]map[string]string)
+	seriesPoints := make(map[string][]point)
+
+	for _, group := range groups {
+		value := c.groupValue(group)
+		if value != math.Trunc(value) || math.Abs(value) > math.MaxInt64/2 {
+			return nil, fmt.Errorf("delta encoding requires integer values, got %v", value)
+		}
+
+		key := tagsKey(group.Tags)
+		seriesTags[key] = group.Tags
+		seriesPoints[key] = append(seriesPoints[key], point{ts: c.rowTimestamp(group), value: int64(value)})
+	}
+
+	keys := make([]string, 0, len(seriesPoints))
+	for key := range seriesPoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	payload := DeltaPayload{
+		TimestampField: c.config.TimestampField,
+		ValueField:     c.outputField(c.valueKeys()[0]),
+		Series:         make([]DeltaSeries, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		points := seriesPoints[key]
+		sort.Slice(points, func(i, j int) bool { return points[i].ts < points[j].ts })
+
+		series := DeltaSeries{
+			Tags:       seriesTags[key],
+			Timestamps: make([]int64, len(points)),
+			Values:     make([]int64, len(points)),
+		}
+
+		var prevTS, prevValue int64
+		for i, p := range points {
+			series.Timestamps[i] = p.ts - prevTS
+			series.Values[i] = p.value - prevValue
+			prevTS, prevValue = p.ts, p.value
+		}
+
+		payload.Series = append(payload.Series, series)
+	}
+
+	return json.Marshal(payload)
+}
+
+// DecodeJSONDelta reconstructs the plain JSON array of rows from CompressJSONDelta output
+func DecodeJSONDelta(data []byte) ([]byte, error) {
+	var payload DeltaPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+
+	output := make([]map[string]interface{}, 0)
+
+	for _, series := range payload.Series {
+		if len(series.Timestamps) != len(series.Values) {
+			return nil, fmt.Errorf("series has %d timestamps but %d values", len(series.Timestamps), len(series.Values))
+		}
+
+		var ts, value int64
+		for i := range series.Timestamps {
+			ts += series.Timestamps[i]
+			value += series.Values[i]
+
+			obj := make(map[string]interface{}, len(series.Tags)+2)
+			for k, v := range series.Tags {
+				obj[k] = v
+			}
+			obj[payload.TimestampField] = ts
+			obj[payload.ValueField] = float64(value)
+
+			output = append(output, obj)
+		}
+	}
+
+	return json.Marshal(output)
+}
+
+// tagsKey returns a stable serialization of a tag set
+func tagsKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(tags[k])
+		sb.WriteByte(';')
+	}
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func deltaTestInput(windows int) []byte {
+	rows := make([]string, 0, windows*4)
+	for w := 0; w < windows; w++ {
+		for _, host := range []string{"web1", "web2"} {
+			ts := 1000 + w*60
+			rows = append(rows,
+				fmt.Sprintf(`{"ts": %d, "bytes": %d, "host": %q}`, ts, 1000+w, host),
+				fmt.Sprintf(`{"ts": %d, "bytes": %d, "host": %q}`, ts+10, 2000+w, host),
+			)
+		}
+	}
+	return []byte("[" + strings.Join(rows, ",") + "]")
+}
+
+func sortedRows(t *testing.T, data []byte) []map[string]interface{} {
+	t.Helper()
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &rows))
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i]["host"] != rows[j]["host"] {
+			return rows[i]["host"].(string) < rows[j]["host"].(string)
+		}
+		return rows[i]["ts"].(float64) < rows[j]["ts"].(float64)
+	})
+	return rows
+}
+
+func TestCompressJSONDelta_RoundTrip(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+	})
+
+	input := deltaTestInput(50)
+
+	plain, err := c.CompressJSON(input)
+	require.NoError(t, err)
+
+	encoded, err := c.CompressJSONDelta(input)
+	require.NoError(t, err)
+
+	decoded, err := DecodeJSONDelta(encoded)
+	require.NoError(t, err)
+
+	require.Equal(t, sortedRows(t, plain), sortedRows(t, decoded))
+	require.Less(t, len(encoded), len(plain))
+
+	t.Logf("Plain %d bytes, delta %d bytes", len(plain), len(encoded))
+}
+
+func TestCompressJSONDelta_NonIntegerValues(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "avg",
+		TimeWindow:        60 * time.Second,
+	})
+
+	_, err := c.CompressJSONDelta([]byte(`[{"ts": 1000, "value": 1}, {"ts": 1010, "value": 2}]`))
+	require.Error(t, err)
+}
+
+func TestDecodeJSONDelta_InvalidInput(t *testing.T) {
+	_, err := DecodeJSONDelta([]byte(`not json`))
+	require.Error(t, err)
+
+	_, err = DecodeJSONDelta([]byte(`{"series": [{"ts": [1, 2], "values": [1]}]}`))
+	require.Error(t, err)
+}
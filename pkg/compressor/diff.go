@@ -0,0 +1,82 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// DiffCompressed returns the rows of curr that are new or changed compared to prev.
+// Rows are matched on the timestamp, group-by and unique fields; a matched row is
+// included when any of its other fields differ. Numeric fields within Config.Epsilon
+// of each other are treated as equal.
+func (c *Compressor) DiffCompressed(prev, curr []byte) ([]byte, error) {
+	var prevRows, currRows []map[string]interface{}
+	if err := json.Unmarshal(prev, &prevRows); err != nil {
+		return nil, fmt.Errorf("invalid previous snapshot: %w", err)
+	}
+	if err := json.Unmarshal(curr, &currRows); err != nil {
+		return nil, fmt.Errorf("invalid current snapshot: %w", err)
+	}
+
+	previous := make(map[string]map[string]interface{}, len(prevRows))
+	for _, row := range prevRows {
+		previous[c.rowKey(row)] = row
+	}
+
+	diff := make([]map[string]interface{}, 0)
+	for _, row := range currRows {
+		if old, ok := previous[c.rowKey(row)]; ok && c.rowsEqual(old, row) {
+			continue
+		}
+		diff = append(diff, row)
+	}
+
+	return json.Marshal(diff)
+}
+
+// rowKey identifies an output row by its timestamp and group fields
+func (c *Compressor) rowKey(row map[string]interface{}) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v", row[c.config.TimestampField])
+
+	if c.config.TenantField != "" {
+		fmt.Fprintf(&sb, ";%s:%v", c.config.TenantField, row[c.config.TenantField])
+	}
+	for _, fields := range [][]string{c.config.GroupByFields, c.config.UniqueFields} {
+		for _, field := range fields {
+			fmt.Fprintf(&sb, ";%s:%v", field, row[field])
+		}
+	}
+	return sb.String()
+}
+
+// rowsEqual compares two decoded rows, treating numbers within Epsilon as equal
+func (c *Compressor) rowsEqual(a, b map[string]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, av := range a {
+		bv, ok := b[key]
+		if !ok {
+			return false
+		}
+
+		af, aNum := av.(float64)
+		bf, bNum := bv.(float64)
+		if aNum && bNum {
+			if math.Abs(af-bf) > c.config.Epsilon {
+				return false
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(av, bv) {
+			return false
+		}
+	}
+	return true
+}
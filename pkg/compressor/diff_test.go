@@ -0,0 +1,84 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCompressed(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+	})
+
+	prev := []byte(`[
+		{"ts": 990, "value": 10, "host": "web1"},
+		{"ts": 990, "value": 20, "host": "web2"},
+		{"ts": 1050, "value": 30, "host": "web1"}
+	]`)
+	curr := []byte(`[
+		{"ts": 990, "value": 10, "host": "web1"},
+		{"ts": 990, "value": 25, "host": "web2"},
+		{"ts": 1050, "value": 30, "host": "web1"}
+	]`)
+
+	result, err := c.DiffCompressed(prev, curr)
+	require.NoError(t, err)
+
+	var diff []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &diff))
+	require.Len(t, diff, 1)
+	require.Equal(t, "web2", diff[0]["host"])
+	require.Equal(t, float64(25), diff[0]["value"])
+}
+
+func TestDiffCompressed_NewRows(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField: "ts",
+		GroupByFields:  []string{"host"},
+	})
+
+	result, err := c.DiffCompressed(
+		[]byte(`[{"ts": 990, "value": 10, "host": "web1"}]`),
+		[]byte(`[{"ts": 990, "value": 10, "host": "web1"}, {"ts": 990, "value": 10, "host": "web3"}]`),
+	)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"ts": 990, "value": 10, "host": "web3"}]`, string(result))
+
+	_, err = c.DiffCompressed([]byte(`oops`), []byte(`[]`))
+	require.Error(t, err)
+}
+
+func TestDiffCompressed_Epsilon(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		Epsilon:           0.01,
+	})
+
+	prev := []byte(`[{"ts": 990, "value": 0.3, "host": "web1"}, {"ts": 990, "value": 1, "host": "web2"}]`)
+	curr := []byte(`[{"ts": 990, "value": 0.30000000000000004, "host": "web1"}, {"ts": 990, "value": 1.5, "host": "web2"}]`)
+
+	result, err := c.DiffCompressed(prev, curr)
+	require.NoError(t, err)
+
+	var diff []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &diff))
+	require.Len(t, diff, 1)
+	require.Equal(t, "web2", diff[0]["host"])
+
+	// Exact comparison by default
+	c.config.Epsilon = 0
+	result, err = c.DiffCompressed(prev, curr)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(result, &diff))
+	require.Len(t, diff, 2)
+}
@@ -0,0 +1,39 @@
+package compressor
+
+// Version is the version of the compressor package reported in output envelopes
+const Version = "1.0.0"
+
+// Envelope wraps compressed rows together with the settings that produced them
+type Envelope struct {
+	Meta EnvelopeMeta             `json:"meta"`
+	Data []map[string]interface{} `json:"data"`
+}
+
+// EnvelopeMeta describes how the rows of an Envelope were produced
+type EnvelopeMeta struct {
+	Version        string            `json:"version"`
+	Method         string            `json:"method"`
+	FieldMethods   map[string]string `json:"field_methods,omitempty"`
+	Window         int64             `json:"window"` // Window size in seconds
+	TimestampField string            `json:"timestamp_field"`
+	ValueFields    []string          `json:"value_fields"`
+	GroupByFields  []string          `json:"group_by_fields,omitempty"`
+	UniqueFields   []string          `json:"unique_fields,omitempty"`
+}
+
+// envelope wraps rows with the compressor's metadata
+func (c *Compressor) envelope(rows []map[string]interface{}) Envelope {
+	return Envelope{
+		Meta: EnvelopeMeta{
+			Version:        Version,
+			Method:         c.config.AggregationMethod,
+			FieldMethods:   c.config.FieldMethods,
+			Window:         int64(c.config.TimeWindow.Seconds()),
+			TimestampField: c.config.TimestampField,
+			ValueFields:    c.config.ValueFields,
+			GroupByFields:  c.config.GroupByFields,
+			UniqueFields:   c.config.UniqueFields,
+		},
+		Data: rows,
+	}
+}
@@ -0,0 +1,39 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressJSON_Envelope(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "avg",
+		TimeWindow:        5 * time.Minute,
+		EmitEnvelope:      true,
+	})
+
+	result, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "cpu": 10, "host": "web1"},
+		{"ts": 1010, "cpu": 30, "host": "web1"}
+	]`))
+	require.NoError(t, err)
+
+	var envelope Envelope
+	require.NoError(t, json.Unmarshal(result, &envelope))
+
+	require.Equal(t, Version, envelope.Meta.Version)
+	require.Equal(t, "avg", envelope.Meta.Method)
+	require.Equal(t, int64(300), envelope.Meta.Window)
+	require.Equal(t, "ts", envelope.Meta.TimestampField)
+	require.Equal(t, []string{"cpu"}, envelope.Meta.ValueFields)
+	require.Equal(t, []string{"host"}, envelope.Meta.GroupByFields)
+
+	require.Len(t, envelope.Data, 1)
+	require.Equal(t, float64(20), envelope.Data[0]["cpu"])
+}
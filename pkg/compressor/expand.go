@@ -0,0 +1,70 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Expand re-expands CompressJSON output into pointsPerWindow evenly spaced synthetic
+// points per row, spread over [window, window+TimeWindow). Sums and counts are divided
+// evenly between the points; every other method repeats the aggregated value. Other
+// row fields such as tags are copied to each point.
+func (c *Compressor) Expand(data []byte, pointsPerWindow int) ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if pointsPerWindow <= 0 {
+		return nil, fmt.Errorf("points per window must be positive, got %d", pointsPerWindow)
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("expected JSON array: %w", err)
+	}
+
+	windowSize := c.windowUnits()
+	step := windowSize / int64(pointsPerWindow)
+
+	output := make([]map[string]interface{}, 0, len(rows)*pointsPerWindow)
+	for _, row := range rows {
+		window := c.windowStart(c.rowTime(row), windowSize)
+
+		for i := 0; i < pointsPerWindow; i++ {
+			point := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				point[k] = v
+			}
+			point[c.config.TimestampField] = c.formatTimestamp(window + int64(i)*step)
+
+			for _, field := range c.valueKeys() {
+				key := c.outputField(field)
+				value, ok := row[key].(float64)
+				if !ok {
+					continue
+				}
+
+				switch c.expandMethod(field) {
+				case "sum", "count":
+					point[key] = value / float64(pointsPerWindow)
+				default:
+					point[key] = value
+				}
+			}
+
+			output = append(output, point)
+		}
+	}
+
+	return json.Marshal(output)
+}
+
+// expandMethod returns the aggregation method a value field was compressed with
+func (c *Compressor) expandMethod(field string) string {
+	if len(c.config.ValueFields) == 0 {
+		return "count"
+	}
+	if method, ok := c.config.FieldMethods[field]; ok {
+		return method
+	}
+	return c.config.AggregationMethod
+}
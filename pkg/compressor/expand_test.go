@@ -0,0 +1,52 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes", "cpu"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		FieldMethods:      map[string]string{"cpu": "avg"},
+		TimeWindow:        60 * time.Second,
+	})
+
+	compressed, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "bytes": 100, "cpu": 40, "host": "web1"},
+		{"ts": 1010, "bytes": 200, "cpu": 60, "host": "web1"}
+	]`))
+	require.NoError(t, err)
+
+	expanded, err := c.Expand(compressed, 4)
+	require.NoError(t, err)
+
+	var points []map[string]interface{}
+	require.NoError(t, json.Unmarshal(expanded, &points))
+	require.Len(t, points, 4)
+
+	total := 0.0
+	for i, point := range points {
+		require.Equal(t, float64(960+i*15), point["ts"]) // spread over [960, 1020)
+		require.Equal(t, float64(50), point["cpu"])      // avg is repeated
+		require.Equal(t, "web1", point["host"])
+		total += point["bytes"].(float64)
+	}
+	require.Equal(t, float64(300), total) // sum is divided evenly
+}
+
+func TestExpand_Errors(t *testing.T) {
+	c := NewCompressor(nil)
+
+	_, err := c.Expand([]byte(`{"timestamp": 1000}`), 4)
+	require.ErrorContains(t, err, "expected JSON array")
+
+	_, err = c.Expand([]byte(`[]`), 0)
+	require.Error(t, err)
+}
@@ -74,7 +74,7 @@ func FuzzAggregate(f *testing.F) {
 			c := NewCompressor(config)
 			
 			// Should not panic
-			result := c.aggregate(values)
+			result := c.aggregate(values, c.config.AggregationMethod)
 			
 			// Verify result is not NaN or Inf
 			if result != result { // NaN check
@@ -131,7 +131,7 @@ func FuzzConfigValidation(f *testing.F) {
 		if c.config.TimestampField == "" {
 			t.Error("TimestampField should have default value")
 		}
-		if len(c.config.ValueFields) == 0 {
+		if len(c.config.ValueFields) == 0 && c.config.AggregationMethod != "count" {
 			t.Error("ValueFields should have default value")
 		}
 		if c.config.AggregationMethod == "" {
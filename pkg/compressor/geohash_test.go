@@ -0,0 +1,53 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeohash(t *testing.T) {
+	// Reference values from the original geohash.org implementation
+	require.Equal(t, "ezs42", geohash(42.6, -5.6, 5))
+	require.Equal(t, "u4pruydqqvj", geohash(57.64911, 10.40744, 11))
+}
+
+func TestCompressor_GeoHashGrouping(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		GeoHashFields:     [2]string{"lat", "lon"},
+		GeoHashPrecision:  5,
+	}
+
+	c := NewCompressor(config)
+
+	// Two points in Berlin, two in Paris
+	input := `[
+		{"ts": 1000, "value": 1, "lat": 52.5200, "lon": 13.4050},
+		{"ts": 1010, "value": 2, "lat": 52.5201, "lon": 13.4052},
+		{"ts": 1000, "value": 10, "lat": 48.8566, "lon": 2.3522},
+		{"ts": 1010, "value": 20, "lat": 48.8567, "lon": 2.3521}
+	]`
+
+	result, err := c.CompressJSON([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+
+	sums := make(map[string]float64)
+	for _, row := range output {
+		sums[row["geohash"].(string)] = row["value"].(float64)
+	}
+
+	require.Equal(t, map[string]float64{
+		geohash(52.52, 13.405, 5):   3,
+		geohash(48.8566, 2.3522, 5): 30,
+	}, sums)
+}
@@ -0,0 +1,70 @@
+package compressor
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// graphiteSanitizer replaces characters that would break a Graphite path segment
+var graphiteSanitizer = strings.NewReplacer(".", "_", " ", "_", "\t", "_", "\n", "_")
+
+// CompressToGraphite aggregates data like CompressJSON and emits one Graphite plaintext
+// line "path value timestamp" per row and value field, the timestamp in epoch seconds.
+// The path is the prefix, the values of the group-by and unique fields, and the value
+// field, joined by dots; each tag and field segment has dots and whitespace replaced
+// by underscores. Lines are sorted by path, then timestamp.
+func (c *Compressor) CompressToGraphite(data []byte, prefix string) ([]byte, error) {
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return nil, err
+	}
+
+	type line struct {
+		path  string
+		value float64
+		ts    int64
+	}
+
+	tagFields := c.tagFields()
+	lines := make([]line, 0, len(groups))
+
+	for _, group := range groups {
+		segments := make([]string, 0, len(tagFields)+2)
+		if prefix != "" {
+			segments = append(segments, prefix)
+		}
+		for _, field := range tagFields {
+			if val, ok := group.Tags[field]; ok && val != "" {
+				segments = append(segments, graphiteSanitizer.Replace(val))
+			}
+		}
+		for _, key := range c.groupValueKeys(group) {
+			lines = append(lines, line{
+				path:  strings.Join(append(segments, graphiteSanitizer.Replace(key)), "."),
+				value: c.fieldValue(group, key),
+				ts:    floorDiv(c.rowTimestamp(group), c.units(time.Second)),
+			})
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].path != lines[j].path {
+			return lines[i].path < lines[j].path
+		}
+		return lines[i].ts < lines[j].ts
+	})
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l.path)
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(l.value, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(l.ts, 10))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
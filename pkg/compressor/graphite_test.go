@@ -0,0 +1,53 @@
+package compressor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressToGraphite(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu"},
+		GroupByFields:     []string{"dc", "host"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	input := `[
+		{"ts": 1000, "cpu": 1.5, "dc": "eu west", "host": "web1.example.com"},
+		{"ts": 1010, "cpu": 2, "dc": "eu west", "host": "web1.example.com"},
+		{"ts": 1000, "cpu": 4, "dc": "us", "host": "db1"},
+		{"ts": 1100, "cpu": 5, "dc": "us", "host": "db1"}
+	]`
+
+	result, err := c.CompressToGraphite([]byte(input), "servers")
+	require.NoError(t, err)
+	require.Equal(t,
+		"servers.eu_west.web1_example_com.cpu 3.5 1005\n"+
+			"servers.us.db1.cpu 4 1000\n"+
+			"servers.us.db1.cpu 5 1100\n",
+		string(result))
+}
+
+func TestCompressToGraphite_Milliseconds(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		TimestampUnit:     "ms",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Second,
+	})
+
+	// Graphite timestamps are always epoch seconds
+	result, err := c.CompressToGraphite([]byte(`[{"ts": 1700000000123, "value": 2}]`), "p")
+	require.NoError(t, err)
+	require.Equal(t, "p.value 2 1700000000\n", string(result))
+}
+
+func TestCompressToGraphite_InvalidInput(t *testing.T) {
+	_, err := NewCompressor(nil).CompressToGraphite([]byte(`{}`), "servers")
+	require.Error(t, err)
+}
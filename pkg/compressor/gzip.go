@@ -0,0 +1,33 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// CompressJSONGzip aggregates data like CompressJSON and gzip-compresses the result
+// at GzipLevel
+func (c *Compressor) CompressJSONGzip(data []byte) ([]byte, error) {
+	compressed, err := c.CompressJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	level := c.config.GzipLevel
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(compressed); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressJSONGzip(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+	}
+	c := NewCompressor(config)
+
+	// The 1000-point dataset of BenchmarkCompressor_MediumBatch
+	input, err := json.Marshal(generateTestData(1000, 50, 1))
+	require.NoError(t, err)
+
+	plain, err := c.CompressJSON(input)
+	require.NoError(t, err)
+
+	gzipped, err := c.CompressJSONGzip(input)
+	require.NoError(t, err)
+
+	zr, err := gzip.NewReader(bytes.NewReader(gzipped))
+	require.NoError(t, err)
+	unzipped, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, plain, unzipped)
+
+	plainRatio, gzipRatio := c.GetCompressionRatio(input, plain), c.GetCompressionRatio(input, gzipped)
+	t.Logf("ratio: %.3f aggregated, %.3f gzipped", plainRatio, gzipRatio)
+	require.Greater(t, gzipRatio, plainRatio)
+	require.Greater(t, gzipRatio, 0.7) // About 0.16 aggregated alone; the random values limit gzip
+
+	// Levels trade speed for size
+	config.GzipLevel = gzip.BestCompression
+	best, err := NewCompressor(config).CompressJSONGzip(input)
+	require.NoError(t, err)
+	config.GzipLevel = gzip.BestSpeed
+	fastest, err := NewCompressor(config).CompressJSONGzip(input)
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(best), len(fastest))
+
+	config.GzipLevel = 12
+	_, err = NewCompressor(config).CompressJSONGzip(input)
+	require.Error(t, err)
+
+	_, err = c.CompressJSONGzip([]byte(`{}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,363 @@
+package compressor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MergeCompressed combines CompressJSON outputs of the same configuration produced
+// by separate shards, re-aggregating rows that share a window and tags. Only methods
+// whose aggregates can be combined are supported: sum, count, min, max, first and last,
+// for AggregationMethod, every FieldMethods entry and every MethodByTag entry.
+// EmitCount counts are summed, EmitDataBounds keep the widest range, CollectFields
+// values are united and EmitRate is recomputed, which needs EmitCount and
+// EmitDataBounds. NestedOutput, RowBuilder and Debug rows cannot be merged.
+// Shards are decoded and rows partitioned by key across Workers goroutines, and the
+// result is sorted by window and tags. Merged timestamps of midpoint methods are the
+// midpoint of the shard timestamps.
+func (c *Compressor) MergeCompressed(shards [][]byte) ([]byte, error) {
+	if err := c.checkMergeable(); err != nil {
+		return nil, err
+	}
+
+	workers := max(c.config.Workers, 1)
+
+	partitioned, err := c.decodeShards(shards, workers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every key lives in exactly one partition, so partitions merge independently;
+	// shards are visited in order to keep first-seen values deterministic
+	merged := make([][]keyedRow, workers)
+	var wg sync.WaitGroup
+	for i := range merged {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			merged[idx] = c.mergePartition(partitioned, idx)
+		}(i)
+	}
+	wg.Wait()
+
+	return json.Marshal(mergeSorted(merged))
+}
+
+// checkMergeable rejects configurations whose rows cannot be re-aggregated
+func (c *Compressor) checkMergeable() error {
+	for _, method := range c.configuredMethods() {
+		switch method {
+		case "sum", "count", "min", "max", "first", "last":
+		default:
+			return fmt.Errorf("aggregation method %q cannot be merged", method)
+		}
+	}
+
+	switch {
+	case c.config.NestedOutput:
+		return errors.New("NestedOutput rows cannot be merged")
+	case c.config.RowBuilder != nil:
+		return errors.New("RowBuilder rows cannot be merged")
+	case c.config.Debug:
+		return errors.New("Debug rows cannot be merged")
+	case c.config.EmitRate && (!c.config.EmitCount || !c.config.EmitDataBounds):
+		return errors.New("merging EmitRate rows requires EmitCount and EmitDataBounds")
+	}
+	return nil
+}
+
+// keyedRow is an output row with its merge key
+type keyedRow struct {
+	key string
+	row map[string]interface{}
+}
+
+// mergedRow accumulates shard rows sharing a merge key
+type mergedRow struct {
+	row          map[string]interface{}
+	method       string
+	values       map[string]float64
+	valueTS      map[string]int64 // timestamp of the row providing each first/last value
+	minTS, maxTS int64
+
+	count               int64
+	dataFirst, dataLast int64
+	collected           map[string][]interface{}
+}
+
+func (m *mergedRow) finish(c *Compressor) map[string]interface{} {
+	var timestamp int64
+	switch m.method {
+	case "first":
+		timestamp = m.minTS
+	case "last":
+		timestamp = m.maxTS
+	default:
+		timestamp = (m.minTS + m.maxTS) / 2
+	}
+	m.row[c.config.TimestampField] = c.formatTimestamp(timestamp)
+	if c.config.EmitISOTimestamp {
+		m.row["timestamp_iso"] = c.isoTimestamp(timestamp)
+	}
+
+	for key, value := range m.values {
+		m.row[key] = value
+	}
+	for field, values := range m.collected {
+		m.row[field] = values
+	}
+
+	if c.config.EmitCount {
+		m.row[c.config.CountField] = m.count
+	}
+	if c.config.EmitDataBounds {
+		m.row["data_first"] = m.dataFirst
+		m.row["data_last"] = m.dataLast
+	}
+	if c.config.EmitRate {
+		span := float64(m.dataLast-m.dataFirst) * c.unit().Seconds()
+		m.row["span_seconds"] = span
+		if span > 0 {
+			m.row["sample_rate"] = float64(m.count) / span
+		} else {
+			m.row["sample_rate"] = float64(0)
+		}
+	}
+	return m.row
+}
+
+// add combines a shard value of one field, aggregated with method, into the row
+func (m *mergedRow) add(key, method string, value float64, ts int64) {
+	current, ok := m.values[key]
+	if !ok {
+		m.values[key], m.valueTS[key] = value, ts
+		return
+	}
+
+	switch method {
+	case "first":
+		if ts < m.valueTS[key] {
+			m.values[key], m.valueTS[key] = value, ts
+		}
+	case "last":
+		if ts > m.valueTS[key] {
+			m.values[key], m.valueTS[key] = value, ts
+		}
+	case "min":
+		m.values[key] = min(current, value)
+	case "max":
+		m.values[key] = max(current, value)
+	default: // sum, count
+		m.values[key] = current + value
+	}
+}
+
+// collect appends the distinct values of a CollectFields array not seen yet
+func (m *mergedRow) collect(field string, values interface{}) {
+	items, _ := values.([]interface{})
+	for _, item := range items {
+		seen := false
+		for _, existing := range m.collected[field] {
+			if existing == item {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			m.collected[field] = append(m.collected[field], item)
+		}
+	}
+}
+
+// mergePartition merges the rows of partition idx across all shards and returns
+// the finished rows sorted by key
+func (c *Compressor) mergePartition(partitioned [][][]keyedRow, idx int) []keyedRow {
+	valueKeys := c.valueKeys()
+	merged := make(map[string]*mergedRow)
+	keys := make([]string, 0)
+
+	for _, partitions := range partitioned {
+		for _, kr := range partitions[idx] {
+			row := kr.row
+			ts := c.rowTime(row)
+
+			m, ok := merged[kr.key]
+			if !ok {
+				m = &mergedRow{
+					row:       row,
+					method:    c.rowMethod(row),
+					values:    make(map[string]float64, len(valueKeys)),
+					valueTS:   make(map[string]int64, len(valueKeys)),
+					minTS:     ts,
+					maxTS:     ts,
+					dataFirst: toInt64(row["data_first"]),
+					dataLast:  toInt64(row["data_last"]),
+					collected: make(map[string][]interface{}, len(c.config.CollectFields)),
+				}
+				merged[kr.key] = m
+				keys = append(keys, kr.key)
+			}
+
+			for _, valueKey := range valueKeys {
+				if value, ok := row[c.outputField(valueKey)].(float64); ok {
+					method := m.method
+					if fieldMethod, ok := c.config.FieldMethods[valueKey]; ok {
+						method = fieldMethod
+					}
+					m.add(c.outputField(valueKey), method, value, ts)
+				}
+			}
+
+			for _, field := range c.config.CollectFields {
+				m.collect(field, row[field])
+			}
+			if c.config.EmitCount {
+				m.count += toInt64(row[c.config.CountField])
+			}
+			if c.config.EmitDataBounds {
+				m.dataFirst = min(m.dataFirst, toInt64(row["data_first"]))
+				m.dataLast = max(m.dataLast, toInt64(row["data_last"]))
+			}
+
+			m.minTS = min(m.minTS, ts)
+			m.maxTS = max(m.maxTS, ts)
+		}
+	}
+
+	sort.Strings(keys)
+	rows := make([]keyedRow, len(keys))
+	for i, key := range keys {
+		rows[i] = keyedRow{key: key, row: merged[key].finish(c)}
+	}
+	return rows
+}
+
+// mergeSorted interleaves the sorted partition results into one sorted slice
+func mergeSorted(parts [][]keyedRow) []map[string]interface{} {
+	total := 0
+	for _, part := range parts {
+		total += len(part)
+	}
+
+	output := make([]map[string]interface{}, 0, total)
+	for len(output) < total {
+		next := -1
+		for i, part := range parts {
+			if len(part) > 0 && (next < 0 || part[0].key < parts[next][0].key) {
+				next = i
+			}
+		}
+		output = append(output, parts[next][0].row)
+		parts[next] = parts[next][1:]
+	}
+	return output
+}
+
+// rowMethod returns the aggregation method of the group an output row was built from
+func (c *Compressor) rowMethod(row map[string]interface{}) string {
+	if c.config.MethodTagField != "" {
+		if method, ok := c.config.MethodByTag[fmt.Sprint(row[c.config.MethodTagField])]; ok {
+			return method
+		}
+	}
+	return c.config.AggregationMethod
+}
+
+// mergeKey identifies the window and tags of an output row. The window is
+// encoded big-endian with the sign bit flipped so keys sort chronologically,
+// pre-1970 windows included.
+func (c *Compressor) mergeKey(row map[string]interface{}) string {
+	window := c.windowStart(c.rowTime(row), c.windowUnits())
+
+	var sb strings.Builder
+	sb.Write(binary.BigEndian.AppendUint64(nil, uint64(window)^(1<<63))) //nolint:gosec // bit pattern only
+
+	if c.config.TenantField != "" {
+		writeKeyPart(&sb, c.config.TenantField, row[c.config.TenantField])
+	}
+	for _, fields := range [][]string{c.config.GroupByFields, c.config.UniqueFields} {
+		for _, field := range fields {
+			writeKeyPart(&sb, field, row[field])
+		}
+	}
+	if row["_overflow"] == true {
+		sb.WriteString(";_overflow")
+	}
+	return sb.String()
+}
+
+// writeKeyPart appends ";field:value" to a merge key
+func writeKeyPart(sb *strings.Builder, field string, value interface{}) {
+	sb.WriteByte(';')
+	sb.WriteString(field)
+	sb.WriteByte(':')
+	if s, ok := value.(string); ok {
+		sb.WriteString(s)
+	} else {
+		fmt.Fprint(sb, value)
+	}
+}
+
+// decodeShards unmarshals the shard outputs using up to workers goroutines and
+// splits the rows of each shard into workers partitions by merge key
+func (c *Compressor) decodeShards(shards [][]byte, workers int) ([][][]keyedRow, error) {
+	partitioned := make([][][]keyedRow, len(shards))
+	errs := make([]error, len(shards))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, workers)
+
+	for i, shard := range shards {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(idx int, data []byte) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			var rows []map[string]interface{}
+			if err := json.Unmarshal(data, &rows); err != nil {
+				errs[idx] = fmt.Errorf("shard %d: %w", idx, err)
+				return
+			}
+
+			partitions := make([][]keyedRow, workers)
+			for _, row := range rows {
+				key := c.mergeKey(row)
+				h := fnv.New32a()
+				_, _ = h.Write([]byte(key))
+				p := int(h.Sum32() % uint32(workers)) //nolint:gosec // workers is positive
+				partitions[p] = append(partitions[p], keyedRow{key: key, row: row})
+			}
+			partitioned[idx] = partitions
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return partitioned, nil
+}
+
+// toInt64 converts a decoded JSON number to int64
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,276 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeCompressed(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+	})
+
+	shard1, err := c.CompressJSON([]byte(`[
+		{"ts": 970, "value": 1, "host": "web1"},
+		{"ts": 1030, "value": 2, "host": "web1"}
+	]`))
+	require.NoError(t, err)
+	shard2, err := c.CompressJSON([]byte(`[
+		{"ts": 1010, "value": 10, "host": "web1"},
+		{"ts": 1010, "value": 20, "host": "web2"}
+	]`))
+	require.NoError(t, err)
+
+	result, err := c.MergeCompressed([][]byte{shard1, shard2})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+
+	require.Equal(t, "web1", output[0]["host"])
+	require.Equal(t, float64(11), output[0]["value"])
+	require.Equal(t, float64(990), output[0]["ts"])
+	require.Equal(t, "web2", output[1]["host"])
+	require.Equal(t, float64(20), output[1]["value"])
+	require.Equal(t, float64(2), output[2]["value"])
+}
+
+func TestMergeCompressed_FirstLast(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "last",
+		TimeWindow:        60 * time.Second,
+	})
+
+	result, err := c.MergeCompressed([][]byte{
+		[]byte(`[{"ts": 1000, "value": 1}]`),
+		[]byte(`[{"ts": 1015, "value": 2}]`),
+	})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(2), output[0]["value"])
+	require.Equal(t, float64(1015), output[0]["ts"])
+}
+
+func TestMergeCompressed_FieldMethods(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu", "bytes"},
+		AggregationMethod: "sum",
+		FieldMethods:      map[string]string{"cpu": "max"},
+		TimeWindow:        60 * time.Second,
+	})
+
+	result, err := c.MergeCompressed([][]byte{
+		[]byte(`[{"ts": 1000, "cpu": 70, "bytes": 100}]`),
+		[]byte(`[{"ts": 1010, "cpu": 50, "bytes": 200}]`),
+	})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(70), output[0]["cpu"])
+	require.Equal(t, float64(300), output[0]["bytes"])
+
+	c = NewCompressor(&Config{FieldMethods: map[string]string{"value": "avg"}})
+	_, err = c.MergeCompressed([][]byte{[]byte(`[]`)})
+	require.Error(t, err)
+}
+
+func TestMergeCompressed_Errors(t *testing.T) {
+	c := NewCompressor(&Config{AggregationMethod: "avg"})
+	_, err := c.MergeCompressed([][]byte{[]byte(`[]`)})
+	require.Error(t, err)
+
+	c = NewCompressor(nil)
+	_, err = c.MergeCompressed([][]byte{[]byte(`[]`), []byte(`invalid`)})
+	require.ErrorContains(t, err, "shard 1")
+}
+
+func TestMergeCompressed_ParallelMatchesSerial(t *testing.T) {
+	shards := mergeTestShards(t, 8)
+
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "max",
+		TimeWindow:        60 * time.Second,
+		Workers:           1,
+	}
+	serial, err := NewCompressor(config).MergeCompressed(shards)
+	require.NoError(t, err)
+
+	config.Workers = 8
+	parallel, err := NewCompressor(config).MergeCompressed(shards)
+	require.NoError(t, err)
+
+	require.JSONEq(t, string(serial), string(parallel))
+}
+
+// mergeTestShards compresses n shards of generated data
+func mergeTestShards(tb testing.TB, n int) [][]byte {
+	tb.Helper()
+
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "max",
+		TimeWindow:        60 * time.Second,
+	})
+
+	shards := make([][]byte, n)
+	for i := range shards {
+		data, err := json.Marshal(generateTestData(1000, 50, i))
+		require.NoError(tb, err)
+
+		shards[i], err = c.CompressJSON(data)
+		require.NoError(tb, err)
+	}
+	return shards
+}
+
+func TestMergeCompressed_TimestampFormat(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		TimestampFormat:   "rfc3339",
+	})
+
+	result, err := c.MergeCompressed([][]byte{
+		[]byte(`[{"ts": "2024-01-02T15:04:00Z", "value": 1}]`),
+		[]byte(`[{"ts": "2024-01-02T15:04:40Z", "value": 2}]`),
+	})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, "2024-01-02T15:04:20Z", output[0]["ts"])
+	require.Equal(t, float64(3), output[0]["value"])
+}
+
+func TestMergeCompressed_RowExtras(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		CollectFields:     []string{"pod"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		EmitCount:         true,
+		EmitDataBounds:    true,
+		EmitRate:          true,
+		EmitISOTimestamp:  true,
+	})
+
+	shard1, err := c.CompressJSON([]byte(`[
+		{"ts": 960, "value": 1, "host": "a", "pod": "p1"},
+		{"ts": 970, "value": 2, "host": "a", "pod": "p2"}
+	]`))
+	require.NoError(t, err)
+	shard2, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "value": 3, "host": "a", "pod": "p2"},
+		{"ts": 1010, "value": 4, "host": "a", "pod": "p3"}
+	]`))
+	require.NoError(t, err)
+
+	result, err := c.MergeCompressed([][]byte{shard1, shard2})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(10), output[0]["value"])
+	require.Equal(t, float64(4), output[0]["count"])
+	require.Equal(t, float64(960), output[0]["data_first"])
+	require.Equal(t, float64(1010), output[0]["data_last"])
+	require.Equal(t, float64(50), output[0]["span_seconds"])
+	require.InDelta(t, 0.08, output[0]["sample_rate"], 1e-9)
+	require.Equal(t, []interface{}{"p1", "p2", "p3"}, output[0]["pod"])
+	require.Equal(t, "1970-01-01T00:16:25Z", output[0]["timestamp_iso"])
+}
+
+func TestMergeCompressed_MethodByTag(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"type"},
+		AggregationMethod: "sum",
+		MethodTagField:    "type",
+		MethodByTag:       map[string]string{"gauge": "last"},
+		TimeWindow:        time.Minute,
+	})
+
+	result, err := c.MergeCompressed([][]byte{
+		[]byte(`[{"ts": 1000, "value": 1, "type": "counter"}, {"ts": 1000, "value": 5, "type": "gauge"}]`),
+		[]byte(`[{"ts": 1010, "value": 2, "type": "counter"}, {"ts": 1010, "value": 7, "type": "gauge"}]`),
+	})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 2)
+	require.Equal(t, "counter", output[0]["type"])
+	require.Equal(t, float64(3), output[0]["value"])
+	require.Equal(t, float64(1005), output[0]["ts"])
+	require.Equal(t, "gauge", output[1]["type"])
+	require.Equal(t, float64(7), output[1]["value"])
+	require.Equal(t, float64(1010), output[1]["ts"])
+
+	c = NewCompressor(&Config{MethodTagField: "type", MethodByTag: map[string]string{"gauge": "avg"}})
+	_, err = c.MergeCompressed([][]byte{[]byte(`[]`)})
+	require.Error(t, err)
+}
+
+func TestMergeCompressed_Unmergeable(t *testing.T) {
+	configs := []*Config{
+		{NestedOutput: true},
+		{Debug: true},
+		{RowBuilder: func(*Group, map[string]float64) map[string]interface{} { return nil }},
+		{EmitRate: true},
+		{EmitRate: true, EmitCount: true},
+	}
+	for _, config := range configs {
+		_, err := NewCompressor(config).MergeCompressed([][]byte{[]byte(`[]`)})
+		require.Error(t, err)
+	}
+}
+
+func TestMergeCompressed_NegativeWindowsSorted(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	result, err := c.MergeCompressed([][]byte{
+		[]byte(`[{"ts": 30, "value": 1}, {"ts": -30, "value": 2}]`),
+		[]byte(`[{"ts": -90, "value": 3}]`),
+	})
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 3)
+	require.Equal(t, float64(-90), output[0]["ts"])
+	require.Equal(t, float64(-30), output[1]["ts"])
+	require.Equal(t, float64(30), output[2]["ts"])
+}
@@ -0,0 +1,61 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OpenTSDB requires at least one tag per data point; this one is added when a group has none
+const (
+	openTSDBDefaultTagKey   = "source"
+	openTSDBDefaultTagValue = "compressor"
+)
+
+// OpenTSDBPoint is a single data point in OpenTSDB's /api/put JSON format
+type OpenTSDBPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// CompressToOpenTSDB aggregates data like CompressJSON and emits the rows as OpenTSDB
+// put points named metric, with group-by and unique fields as tags. With several value
+// fields each row yields one point per field, named metric.field.
+func (c *Compressor) CompressToOpenTSDB(data []byte, metric string) ([]byte, error) {
+	if metric == "" {
+		return nil, fmt.Errorf("metric name is required")
+	}
+
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]OpenTSDBPoint, 0, len(groups))
+	for _, group := range c.orderedGroups(groups) {
+		tags := make(map[string]string, len(group.Tags))
+		for k, v := range group.Tags {
+			tags[k] = v
+		}
+		if len(tags) == 0 {
+			tags[openTSDBDefaultTagKey] = openTSDBDefaultTagValue
+		}
+
+		keys := c.groupValueKeys(group)
+		for _, key := range keys {
+			name := metric
+			if len(keys) > 1 {
+				name = metric + "." + key
+			}
+			points = append(points, OpenTSDBPoint{
+				Metric:    name,
+				Timestamp: c.rowTimestamp(group),
+				Value:     c.fieldValue(group, key),
+				Tags:      tags,
+			})
+		}
+	}
+
+	return json.Marshal(points)
+}
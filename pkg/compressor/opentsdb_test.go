@@ -0,0 +1,51 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressToOpenTSDB(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"cpu"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "avg",
+		TimeWindow:        time.Minute,
+	})
+
+	result, err := c.CompressToOpenTSDB([]byte(`[
+		{"ts": 1000, "cpu": 10, "host": "web1"},
+		{"ts": 1010, "cpu": 30, "host": "web1"}
+	]`), "sys.cpu.user")
+	require.NoError(t, err)
+
+	var points []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &points))
+	require.Len(t, points, 1)
+
+	point := points[0]
+	require.Len(t, point, 4)
+	require.Equal(t, "sys.cpu.user", point["metric"])
+	require.Equal(t, float64(1005), point["timestamp"])
+	require.Equal(t, float64(20), point["value"])
+	require.Equal(t, map[string]interface{}{"host": "web1"}, point["tags"])
+}
+
+func TestCompressToOpenTSDB_DefaultTag(t *testing.T) {
+	c := NewCompressor(nil)
+
+	result, err := c.CompressToOpenTSDB([]byte(`[{"timestamp": 1000, "value": 1}]`), "events")
+	require.NoError(t, err)
+
+	var points []OpenTSDBPoint
+	require.NoError(t, json.Unmarshal(result, &points))
+	require.Len(t, points, 1)
+	require.Equal(t, map[string]string{"source": "compressor"}, points[0].Tags)
+
+	_, err = c.CompressToOpenTSDB([]byte(`[]`), "")
+	require.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package compressor
+
+import (
+	"io"
+	"slices"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// CompressToParquet aggregates data like CompressJSON and writes the rows to w as a
+// Parquet file with a single row group. The timestamp is an int64 column, each value
+// field an optional double column and every group-by and unique field an optional
+// string column.
+func (c *Compressor) CompressToParquet(data []byte, w io.Writer) error {
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return err
+	}
+
+	tagFields := c.tagFields()
+
+	fields := parquet.Group{
+		c.config.TimestampField: parquet.Leaf(parquet.Int64Type),
+	}
+	for _, key := range c.parquetValueKeys() {
+		fields[c.outputField(key)] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+	}
+	for _, field := range tagFields {
+		fields[field] = parquet.Optional(parquet.String())
+	}
+	schema := parquet.NewSchema("compressed", fields)
+
+	writer := parquet.NewGenericWriter[map[string]any](w, schema)
+
+	rows := make([]map[string]any, 0, len(groups))
+	for _, group := range c.orderedGroups(groups) {
+		row := map[string]any{
+			c.config.TimestampField: c.rowTimestamp(group),
+		}
+		for key, value := range c.groupAggregates(group) {
+			row[key] = value
+		}
+		for _, field := range tagFields {
+			if val, ok := group.Tags[field]; ok {
+				row[field] = val
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// parquetValueKeys returns the value columns of the file: every FieldWindows field
+// in addition to the regular value fields
+func (c *Compressor) parquetValueKeys() []string {
+	keys := c.valueKeys()
+	for field := range c.config.FieldWindows {
+		if !slices.Contains(keys, field) {
+			keys = append(slices.Clone(keys), field)
+		}
+	}
+	return keys
+}
+
+// tagFields returns the names of all tags a group may carry
+func (c *Compressor) tagFields() []string {
+	fields := make([]string, 0, len(c.config.GroupByFields)+len(c.config.UniqueFields)+2)
+	if c.config.TenantField != "" {
+		fields = append(fields, c.config.TenantField)
+	}
+	fields = append(fields, c.config.GroupByFields...)
+	fields = append(fields, c.config.UniqueFields...)
+	if c.config.GeoHashFields[0] != "" {
+		fields = append(fields, "geohash")
+	}
+	return fields
+}
@@ -0,0 +1,56 @@
+package compressor
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressToParquet(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		SortForInsert:     true,
+	})
+
+	input := `[
+		{"ts": 1000, "value": 1, "host": "web1"},
+		{"ts": 1010, "value": 2, "host": "web1"},
+		{"ts": 1000, "value": 5, "host": "web2"}
+	]`
+
+	var buf bytes.Buffer
+	require.NoError(t, c.CompressToParquet([]byte(input), &buf))
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), file.NumRows())
+
+	reader := parquet.NewGenericReader[map[string]any](file, file.Schema())
+	defer reader.Close()
+
+	rows := []map[string]any{{}, {}}
+	n, err := reader.Read(rows)
+	require.Equal(t, 2, n)
+	require.ErrorIs(t, err, io.EOF)
+
+	require.Equal(t, "web1", rows[0]["host"])
+	require.Equal(t, int64(1005), rows[0]["ts"])
+	require.Equal(t, float64(3), rows[0]["value"])
+
+	require.Equal(t, "web2", rows[1]["host"])
+	require.Equal(t, int64(1000), rows[1]["ts"])
+	require.Equal(t, float64(5), rows[1]["value"])
+}
+
+func TestCompressToParquet_InvalidInput(t *testing.T) {
+	var buf bytes.Buffer
+	require.Error(t, NewCompressor(nil).CompressToParquet([]byte(`{}`), &buf))
+}
@@ -0,0 +1,185 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/tidwall/gjson"
+)
+
+// Stage is one transform of Config.Pipeline. Stages exchange JSON arrays of records,
+// so every stage but the last aggregate should keep the default array output.
+type Stage struct {
+	// Name is "aggregate" (window aggregation as without a pipeline), "downsample"
+	// (Largest-Triangle-Three-Buckets per series) or "deadband" (drop records whose
+	// value changed by no more than Threshold since the last kept one of the series)
+	Name string
+
+	Points    int     // Records kept per series by "downsample", at least 3
+	Threshold float64 // Deadband of "deadband"
+}
+
+// stagePoint is a record of a series passing through a downsample or deadband stage
+type stagePoint struct {
+	timestamp int64
+	value     float64
+	raw       string
+}
+
+// compressPipeline runs data through each stage of Config.Pipeline in order. Each
+// stage uses the full config, except that stages after the first read JSON arrays
+// and only the last applies OutputFormat.
+// The stats are those of the last aggregate stage, with the sizes of the whole run.
+func (c *Compressor) compressPipeline(input []byte) ([]byte, CompressionStats, error) {
+	data := input
+	config := c.config
+	config.Pipeline = nil
+	config.CacheSize = 0
+
+	var stats CompressionStats
+	for i, stage := range c.config.Pipeline {
+		if i > 0 {
+			config.InputFormat = ""
+		}
+		if i < len(c.config.Pipeline)-1 {
+			config.OutputFormat = ""
+		} else {
+			config.OutputFormat = c.config.OutputFormat
+		}
+		sc := NewCompressor(&config)
+
+		var err error
+		switch stage.Name {
+		case "aggregate":
+			data, stats, err = sc.compress(data)
+		case "downsample":
+			if stage.Points < 3 {
+				return nil, stats, fmt.Errorf("downsample stage needs at least 3 points, got %d", stage.Points)
+			}
+			data, err = sc.filterSeries(data, func(points []stagePoint) []stagePoint {
+				return lttb(points, stage.Points)
+			})
+		case "deadband":
+			data, err = sc.filterSeries(data, func(points []stagePoint) []stagePoint {
+				return deadband(points, stage.Threshold)
+			})
+		default:
+			return nil, stats, fmt.Errorf("unknown pipeline stage %q", stage.Name)
+		}
+		if err != nil {
+			return nil, stats, fmt.Errorf("pipeline stage %d (%s): %w", i, stage.Name, err)
+		}
+	}
+	stats.sizes(input, data)
+	return data, stats, nil
+}
+
+// filterSeries splits the records of data into series by their group-by fields, sorts
+// each by timestamp and keeps the records chosen by keep, unchanged and in timestamp
+// order. Records without a valid timestamp are dropped.
+func (c *Compressor) filterSeries(data []byte, keep func([]stagePoint) []stagePoint) ([]byte, error) {
+	series := make(map[string][]stagePoint)
+	order := make([]string, 0)
+
+	err := c.forEachRecord(data, func(record gjson.Result) bool {
+		if !record.IsObject() {
+			return true
+		}
+		timestamp, ok := c.extractTimestamp(record)
+		if !ok {
+			return true
+		}
+
+		var value float64
+		if len(c.config.ValueFields) > 0 {
+			value, _ = c.numericValue(record.Get(c.config.ValueFields[0]))
+		}
+
+		key := c.markerSeries(record)
+		if _, ok := series[key]; !ok {
+			order = append(order, key)
+		}
+		series[key] = append(series[key], stagePoint{timestamp: timestamp, value: value, raw: record.Raw})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]stagePoint, 0)
+	for _, key := range order {
+		points := series[key]
+		sort.SliceStable(points, func(i, j int) bool { return points[i].timestamp < points[j].timestamp })
+		kept = append(kept, keep(points)...)
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].timestamp < kept[j].timestamp })
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, p := range kept {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(p.raw)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// lttb selects n of the time-ordered points with the Largest-Triangle-Three-Buckets
+// algorithm, always keeping the first and last point
+func lttb(points []stagePoint, n int) []stagePoint {
+	if len(points) <= n {
+		return points
+	}
+
+	sampled := make([]stagePoint, 0, n)
+	sampled = append(sampled, points[0])
+
+	// The points between the first and last are split into n-2 buckets
+	bound := func(i int) int { return i*(len(points)-2)/(n-2) + 1 }
+	prev := 0
+	for i := 0; i < n-2; i++ {
+		start, end := bound(i), bound(i+1)
+
+		// The third vertex is the average of the next bucket, or the last point
+		nextEnd := min(bound(i+2), len(points))
+		var avgX, avgY float64
+		for _, p := range points[end:nextEnd] {
+			avgX += float64(p.timestamp)
+			avgY += p.value
+		}
+		count := float64(nextEnd - end)
+		avgX /= count
+		avgY /= count
+
+		best, bestArea := start, -1.0
+		a := points[prev]
+		for j := start; j < end; j++ {
+			area := math.Abs((float64(a.timestamp)-avgX)*(points[j].value-a.value) -
+				(float64(a.timestamp)-float64(points[j].timestamp))*(avgY-a.value))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+
+		sampled = append(sampled, points[best])
+		prev = best
+	}
+
+	return append(sampled, points[len(points)-1])
+}
+
+// deadband keeps the first point and each point whose value differs from the last
+// kept one by more than threshold
+func deadband(points []stagePoint, threshold float64) []stagePoint {
+	kept := make([]stagePoint, 0, len(points))
+	for _, p := range points {
+		if len(kept) == 0 || math.Abs(p.value-kept[len(kept)-1].value) > threshold {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
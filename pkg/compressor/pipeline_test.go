@@ -0,0 +1,105 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pipelineTestInput() []byte {
+	// A dense, flat series with one spike at 1050
+	records := make([]string, 0, 120)
+	for ts := 1000; ts < 1120; ts++ {
+		value := 1
+		if ts == 1050 {
+			value = 100
+		}
+		records = append(records, fmt.Sprintf(`{"ts": %d, "value": %d, "host": "web1"}`, ts, value))
+	}
+	return []byte("[" + strings.Join(records, ",") + "]")
+}
+
+func pipelineTestConfig(stages ...Stage) *Config {
+	return &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		Pipeline:          stages,
+	}
+}
+
+func TestPipeline_DownsampleThenAggregate(t *testing.T) {
+	input := pipelineTestInput()
+
+	downsampled, err := NewCompressor(pipelineTestConfig(Stage{Name: "downsample", Points: 10})).CompressJSON(input)
+	require.NoError(t, err)
+
+	var points []map[string]interface{}
+	require.NoError(t, json.Unmarshal(downsampled, &points))
+	require.Len(t, points, 10)
+	require.Equal(t, float64(1000), points[0]["ts"])
+	require.Equal(t, float64(1119), points[9]["ts"])
+
+	kept := make([]float64, 0, len(points))
+	for _, p := range points {
+		kept = append(kept, p["ts"].(float64))
+	}
+	require.Contains(t, kept, float64(1050)) // LTTB keeps the spike
+
+	// The composed pipeline aggregates exactly the downsampled records
+	combined, err := NewCompressor(pipelineTestConfig(
+		Stage{Name: "downsample", Points: 10},
+		Stage{Name: "aggregate"},
+	)).CompressJSON(input)
+	require.NoError(t, err)
+
+	expected, err := NewCompressor(pipelineTestConfig()).CompressJSON(downsampled)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(combined))
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(combined, &rows))
+	require.Len(t, rows, 3) // The 960, 1020 and 1080 windows
+
+	total := 0.0
+	for _, row := range rows {
+		total += row["value"].(float64)
+	}
+	require.Equal(t, float64(109), total) // The spike plus nine flat points
+}
+
+func TestPipeline_Deadband(t *testing.T) {
+	c := NewCompressor(pipelineTestConfig(Stage{Name: "deadband", Threshold: 0.1}))
+
+	result, err := c.CompressJSON([]byte(`[
+		{"ts": 1000, "value": 1, "host": "a"},
+		{"ts": 1001, "value": 1.05, "host": "a"},
+		{"ts": 1001, "value": 7, "host": "b"},
+		{"ts": 1002, "value": 2, "host": "a"},
+		{"ts": 1003, "value": 2.02, "host": "a"},
+		{"ts": 1004, "value": 1.95, "host": "a"}
+	]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{"ts": 1000, "value": 1, "host": "a"},
+		{"ts": 1001, "value": 7, "host": "b"},
+		{"ts": 1002, "value": 2, "host": "a"}
+	]`, string(result))
+}
+
+func TestPipeline_Errors(t *testing.T) {
+	_, err := NewCompressor(pipelineTestConfig(Stage{Name: "smooth"})).CompressJSON([]byte(`[]`))
+	require.ErrorContains(t, err, `unknown pipeline stage "smooth"`)
+
+	_, err = NewCompressor(pipelineTestConfig(Stage{Name: "downsample", Points: 2})).CompressJSON([]byte(`[]`))
+	require.ErrorContains(t, err, "at least 3 points")
+
+	_, err = NewCompressor(pipelineTestConfig(Stage{Name: "deadband"})).CompressJSON([]byte(`{}`))
+	require.ErrorContains(t, err, "expected JSON array")
+}
@@ -0,0 +1,138 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// SchemaPayload is the columnar form produced with Config.EmitSchemaHeader: the
+// schema lists every output field once, and each row holds the field values in
+// schema order, null where the row lacks the field
+type SchemaPayload struct {
+	Schema []SchemaField   `json:"schema"`
+	Rows   [][]interface{} `json:"rows"`
+}
+
+// SchemaField names an output column and its type: "int64", "float64", "string",
+// "bool" or "json" for anything else
+type SchemaField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// schemaPayload converts output rows to the columnar form
+func schemaPayload(rows []map[string]interface{}) SchemaPayload {
+	types := make(map[string]string)
+	for _, row := range rows {
+		for name, value := range row {
+			if _, ok := types[name]; !ok {
+				types[name] = schemaType(value)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	payload := SchemaPayload{
+		Schema: make([]SchemaField, 0, len(names)),
+		Rows:   make([][]interface{}, 0, len(rows)),
+	}
+	for _, name := range names {
+		payload.Schema = append(payload.Schema, SchemaField{Name: name, Type: types[name]})
+	}
+
+	for _, row := range rows {
+		values := make([]interface{}, len(names))
+		for i, name := range names {
+			values[i] = row[name]
+		}
+		payload.Rows = append(payload.Rows, values)
+	}
+	return payload
+}
+
+// schemaType returns the schema type of an output value
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case int, int64:
+		return "int64"
+	case float64:
+		return "float64"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	default:
+		return "json"
+	}
+}
+
+// DecodeSchemaRows reconstructs the plain JSON array of rows from output produced
+// with EmitSchemaHeader, typing each value by its schema field
+func DecodeSchemaRows(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var payload SchemaPayload
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	output := make([]map[string]interface{}, 0, len(payload.Rows))
+	for i, values := range payload.Rows {
+		if len(values) != len(payload.Schema) {
+			return nil, fmt.Errorf("row %d has %d values but the schema has %d fields", i, len(values), len(payload.Schema))
+		}
+
+		row := make(map[string]interface{}, len(values))
+		for j, field := range payload.Schema {
+			if values[j] == nil {
+				continue
+			}
+
+			value, err := schemaValue(field, values[j])
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i, err)
+			}
+			row[field.Name] = value
+		}
+		output = append(output, row)
+	}
+
+	return json.Marshal(output)
+}
+
+// schemaValue converts a decoded value to the type of its schema field
+func schemaValue(field SchemaField, value interface{}) (interface{}, error) {
+	number, isNumber := value.(json.Number)
+
+	switch field.Type {
+	case "int64":
+		if isNumber {
+			return number.Int64()
+		}
+	case "float64":
+		if isNumber {
+			return number.Float64()
+		}
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "json":
+		return value, nil
+	default:
+		return nil, fmt.Errorf("field %q has unknown type %q", field.Name, field.Type)
+	}
+	return nil, fmt.Errorf("field %q: %v is not of type %s", field.Name, value, field.Type)
+}
@@ -0,0 +1,64 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitSchemaHeader_RoundTrip(t *testing.T) {
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"bytes"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+		EmitRate:          true,
+		SortForInsert:     true,
+	}
+	plain, err := NewCompressor(config).CompressJSON(deltaTestInput(3))
+	require.NoError(t, err)
+
+	config.EmitSchemaHeader = true
+	columnar, err := NewCompressor(config).CompressJSON(deltaTestInput(3))
+	require.NoError(t, err)
+	require.Less(t, len(columnar), len(plain))
+
+	var payload SchemaPayload
+	require.NoError(t, json.Unmarshal(columnar, &payload))
+	require.Equal(t, []SchemaField{
+		{Name: "bytes", Type: "float64"},
+		{Name: "host", Type: "string"},
+		{Name: "sample_rate", Type: "float64"},
+		{Name: "span_seconds", Type: "float64"},
+		{Name: "ts", Type: "int64"},
+	}, payload.Schema)
+	require.Len(t, payload.Rows, 6)
+	require.Equal(t, []interface{}{float64(3000), "web1", 0.2, float64(10), float64(1005)}, payload.Rows[0])
+
+	decoded, err := DecodeSchemaRows(columnar)
+	require.NoError(t, err)
+	require.JSONEq(t, string(plain), string(decoded))
+}
+
+func TestDecodeSchemaRows_Errors(t *testing.T) {
+	_, err := DecodeSchemaRows([]byte(`invalid`))
+	require.Error(t, err)
+
+	_, err = DecodeSchemaRows([]byte(`{"schema": [{"name": "ts", "type": "int64"}], "rows": [[1, 2]]}`))
+	require.ErrorContains(t, err, "row 0 has 2 values")
+
+	_, err = DecodeSchemaRows([]byte(`{"schema": [{"name": "ts", "type": "int64"}], "rows": [["now"]]}`))
+	require.ErrorContains(t, err, "not of type int64")
+
+	_, err = DecodeSchemaRows([]byte(`{"schema": [{"name": "ts", "type": "time"}], "rows": [[1]]}`))
+	require.ErrorContains(t, err, "unknown type")
+
+	// Missing fields are null and stay absent
+	decoded, err := DecodeSchemaRows([]byte(`{"schema": [{"name": "a", "type": "bool"}, {"name": "b", "type": "json"}],
+		"rows": [[true, null], [null, {"x": 1}]]}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"a": true}, {"b": {"x": 1}}]`, string(decoded))
+}
@@ -0,0 +1,138 @@
+package compressor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// groupSpill writes partial groups to temporary files once the records held in
+// memory exceed SpillThresholdBytes, and merges them back in a final pass
+type groupSpill struct {
+	dir   string
+	files []*os.File
+}
+
+// spilledGroup is a single line of a spill file
+type spilledGroup struct {
+	Key   string `json:"key"`
+	Group *Group `json:"group"`
+}
+
+func newGroupSpill(dir string) *groupSpill {
+	return &groupSpill{dir: dir}
+}
+
+// write stores the groups in a new temporary file
+func (s *groupSpill) write(groups map[string]*Group) error {
+	f, err := os.CreateTemp(s.dir, "compressor-spill-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("create spill file: %w", err)
+	}
+	s.files = append(s.files, f)
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for key, group := range groups {
+		if err := enc.Encode(spilledGroup{Key: key, Group: group}); err != nil {
+			return fmt.Errorf("write spill file: %w", err)
+		}
+	}
+	return w.Flush()
+}
+
+// merge combines the spilled groups with the groups still in memory, in the
+// order they were ingested
+func (s *groupSpill) merge(groups map[string]*Group) (map[string]*Group, error) {
+	merged := make(map[string]*Group)
+
+	for _, f := range s.files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("read spill file: %w", err)
+		}
+
+		dec := json.NewDecoder(bufio.NewReader(f))
+		for {
+			var entry spilledGroup
+			if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("read spill file: %w", err)
+			}
+			mergeInto(merged, entry.Key, entry.Group)
+		}
+	}
+
+	for key, group := range groups {
+		mergeInto(merged, key, group)
+	}
+	return merged, nil
+}
+
+// Close removes the spill files
+func (s *groupSpill) Close() {
+	for _, f := range s.files {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	s.files = nil
+}
+
+// mergeInto adds src to the group stored under key, appending its values after the
+// existing ones. Running aggregates, which spill only with MultiplicityField (see
+// canAccumulate), are merged instead.
+func mergeInto(groups map[string]*Group, key string, src *Group) {
+	dst, ok := groups[key]
+	if !ok {
+		groups[key] = src
+		return
+	}
+	dst.merge(src)
+}
+
+// merge folds the records of src into g
+func (g *Group) merge(src *Group) {
+	if g.Count == 0 || src.SrcStart < g.SrcStart {
+		g.SrcStart = src.SrcStart
+	}
+	g.SrcEnd = max(g.SrcEnd, src.SrcEnd)
+	g.FirstTime = min(g.FirstTime, src.FirstTime)
+	g.LastTime = max(g.LastTime, src.LastTime)
+	g.Count += src.Count
+
+	if g.Fields == nil {
+		g.Fields = make(map[string]*FieldAggregate, len(src.Fields))
+	}
+	for field, s := range src.Fields {
+		d, ok := g.Fields[field]
+		if !ok {
+			g.Fields[field] = s
+			continue
+		}
+		d.Values = append(d.Values, s.Values...)
+		d.Times = append(d.Times, s.Times...)
+		d.Ties = append(d.Ties, s.Ties...)
+		d.OrderKeys = append(d.OrderKeys, s.OrderKeys...)
+		if d.Running != nil && s.Running != nil {
+			d.Running.merge(s.Running)
+		}
+	}
+
+	for field, values := range src.Collected {
+		for _, value := range values {
+			g.collect(field, value)
+		}
+	}
+
+	for field, value := range src.Passthrough {
+		if _, ok := g.Passthrough[field]; !ok {
+			if g.Passthrough == nil {
+				g.Passthrough = make(map[string]interface{}, len(src.Passthrough))
+			}
+			g.Passthrough[field] = value
+		}
+	}
+}
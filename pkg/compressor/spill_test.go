@@ -0,0 +1,118 @@
+package compressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressJSON_SpillMatchesInMemory(t *testing.T) {
+	data, err := json.Marshal(generateTestData(500, 5, 1))
+	require.NoError(t, err)
+
+	for _, method := range []string{"sum", "avg", "max", "first", "last", "count"} {
+		t.Run(method, func(t *testing.T) {
+			config := &Config{
+				TimestampField:    "ts",
+				ValueFields:       []string{"value"},
+				GroupByFields:     []string{"host"},
+				CollectFields:     []string{"host"},
+				AggregationMethod: method,
+				SortForInsert:     true,
+			}
+			expected, err := NewCompressor(config).CompressJSON(data)
+			require.NoError(t, err)
+
+			dir := t.TempDir()
+			config.SpillThresholdBytes = 2000
+			config.SpillDir = dir
+
+			result, stats, err := NewCompressor(config).CompressJSONStats(data)
+			require.NoError(t, err)
+			require.JSONEq(t, string(expected), string(result))
+			require.Equal(t, 500, stats.Records)
+
+			// Spill files are removed once merged
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestCompressJSON_SpillDirError(t *testing.T) {
+	config := DefaultConfig()
+	config.SpillThresholdBytes = 1
+	config.SpillDir = fmt.Sprintf("%s/missing", t.TempDir())
+
+	_, err := NewCompressor(config).CompressJSON([]byte(`[{"timestamp": 1000, "value": 1}]`))
+	require.ErrorContains(t, err, "spill")
+}
+
+func TestCompressJSON_SpillMultiplicity(t *testing.T) {
+	records := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		records = append(records, fmt.Sprintf(`{"timestamp": %d, "value": %d, "n": %d}`, 1000+i%5, i%7, 1+i%3))
+	}
+	data := []byte("[" + strings.Join(records, ",") + "]")
+
+	// Running aggregates are spilled and merged back for every method that keeps one
+	for _, method := range []string{"sum", "avg", "count", "min", "max"} {
+		t.Run(method, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AggregationMethod = method
+			config.MultiplicityField = "n"
+			expected, err := NewCompressor(config).CompressJSON(data)
+			require.NoError(t, err)
+
+			// Both when the threshold is reached and when it is not
+			for _, threshold := range []int{500, 1 << 20} {
+				config.SpillThresholdBytes = threshold
+				config.SpillDir = t.TempDir()
+
+				result, err := NewCompressor(config).CompressJSON(data)
+				require.NoError(t, err)
+				require.JSONEq(t, string(expected), string(result))
+			}
+		})
+	}
+
+	// Spilling after every record still weights each one
+	config := DefaultConfig()
+	config.MultiplicityField = "n"
+	config.SpillThresholdBytes = 1
+	config.SpillDir = t.TempDir()
+	result, err := NewCompressor(config).CompressJSON([]byte(`[
+		{"timestamp": 1000, "value": 5, "n": 100},
+		{"timestamp": 1005, "value": 2, "n": 3},
+		{"timestamp": 1010, "value": 1}
+	]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"timestamp": 1005, "value": 507}]`, string(result))
+}
+
+func TestCompressJSON_SpillHashGroupKeys(t *testing.T) {
+	data, err := json.Marshal(generateTestData(200, 3, 1))
+	require.NoError(t, err)
+
+	config := &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		HashGroupKeys:     true,
+	}
+	expected, err := NewCompressor(config).CompressJSON(data)
+	require.NoError(t, err)
+
+	config.SpillThresholdBytes = 2000
+	config.SpillDir = t.TempDir()
+
+	result, err := NewCompressor(config).CompressJSON(data)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(result))
+}
@@ -0,0 +1,62 @@
+package compressor
+
+import "time"
+
+// CompressionStats describes how a payload was compressed
+type CompressionStats struct {
+	Records    int // Input records accepted into a group
+	Skipped    int // Input elements skipped (non-objects, missing timestamp or group fields)
+	OutOfRange int // Records rejected by MinTimestamp/MaxTimestamp
+	Groups     int // Number of aggregated groups
+	Rows       int // Output rows
+
+	Passthrough bool // The original payload was returned because of MinUsefulRatio
+
+	BytesIn  int     // Size of the input payload
+	BytesOut int     // Size of the returned output
+	Ratio    float64 // Size reduction as GetCompressionRatio, negative if the output grew
+
+	ParseDuration     time.Duration // Parsing and grouping the input
+	AggregateDuration time.Duration // Aggregating groups into output rows
+	MarshalDuration   time.Duration // Encoding the output
+}
+
+// recordResult is the outcome of adding a single input element
+type recordResult int
+
+const (
+	recordAdded recordResult = iota
+	recordSkipped
+	recordOutOfRange
+)
+
+func (s *CompressionStats) count(result recordResult) {
+	switch result {
+	case recordAdded:
+		s.Records++
+	case recordSkipped:
+		s.Skipped++
+	case recordOutOfRange:
+		s.OutOfRange++
+	}
+}
+
+// sizes records the input and output sizes and their ratio
+func (s *CompressionStats) sizes(input, output []byte) {
+	s.BytesIn, s.BytesOut = len(input), len(output)
+	s.Ratio = compressionRatio(s.BytesIn, s.BytesOut)
+}
+
+// compressionRatio returns 1 - output/input, or 0 for an empty input
+func compressionRatio(input, output int) float64 {
+	if input == 0 {
+		return 0
+	}
+	return 1.0 - float64(output)/float64(input)
+}
+
+// CompressJSONStats compresses data like CompressJSON and also returns the stats of
+// the call. It always recomputes, bypassing the result cache.
+func (c *Compressor) CompressJSONStats(data []byte) ([]byte, CompressionStats, error) {
+	return c.compress(data)
+}
@@ -0,0 +1,148 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressJSON_TimestampRange(t *testing.T) {
+	minTS, maxTS := int64(946684800), int64(4102444800) // 2000-01-01 .. 2100-01-01
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		MinTimestamp:      &minTS,
+		MaxTimestamp:      &maxTS,
+	})
+
+	input := `[
+		{"ts": 1700000000, "value": 1},
+		{"ts": 1700000010, "value": 2},
+		{"ts": 7258118400, "value": 100},
+		{"ts": -2208988800, "value": 100},
+		"junk"
+	]`
+
+	result, stats, err := c.CompressJSONStats([]byte(input))
+	require.NoError(t, err)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(3), output[0]["value"])
+
+	require.Equal(t, 2, stats.Records)
+	require.Equal(t, 1, stats.Skipped)
+	require.Equal(t, 2, stats.OutOfRange)
+	require.Equal(t, 1, stats.Groups)
+}
+
+func TestCompressJSON_OnComplete(t *testing.T) {
+	var calls []CompressionStats
+
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "avg",
+		TimeWindow:        time.Minute,
+		OnComplete: func(stats CompressionStats) {
+			calls = append(calls, stats)
+		},
+	})
+
+	data, err := json.Marshal(generateTestData(1000, 10, 1))
+	require.NoError(t, err)
+
+	_, err = c.CompressJSON(data)
+	require.NoError(t, err)
+
+	require.Len(t, calls, 1)
+	require.Equal(t, 1000, calls[0].Records)
+	require.Positive(t, calls[0].ParseDuration)
+	require.Positive(t, calls[0].AggregateDuration)
+	require.Positive(t, calls[0].MarshalDuration)
+
+	// Failed calls do not report
+	_, err = c.CompressJSON([]byte(`{}`))
+	require.Error(t, err)
+	require.Len(t, calls, 1)
+}
+
+func TestCompressJSON_MinUsefulRatio(t *testing.T) {
+	config := DefaultConfig()
+	config.MinUsefulRatio = 0.2
+	c := NewCompressor(config)
+
+	// One record per window: aggregation cannot shrink the payload
+	input := []byte(`[{"timestamp": 1000, "value": 1}, {"timestamp": 2000, "value": 2}, {"timestamp": 3000, "value": 3}]`)
+
+	result, stats, err := c.CompressJSONStats(input)
+	require.NoError(t, err)
+	require.True(t, stats.Passthrough)
+	require.Equal(t, input, result)
+	require.Equal(t, len(input), stats.BytesOut)
+	require.Equal(t, float64(0), stats.Ratio)
+
+	// Many records in one window compress well and are aggregated
+	dense := []byte(`[
+		{"timestamp": 1000, "value": 1}, {"timestamp": 1001, "value": 2},
+		{"timestamp": 1002, "value": 3}, {"timestamp": 1003, "value": 4}
+	]`)
+
+	result, stats, err = c.CompressJSONStats(dense)
+	require.NoError(t, err)
+	require.False(t, stats.Passthrough)
+
+	var output []map[string]interface{}
+	require.NoError(t, json.Unmarshal(result, &output))
+	require.Len(t, output, 1)
+	require.Equal(t, float64(10), output[0]["value"])
+}
+
+func TestCompressJSONStats_Sizes(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	input := []byte(`[
+		{"ts": 1000, "value": 1, "host": "a"},
+		{"ts": 1001, "value": 2, "host": "a"},
+		{"ts": 1002, "value": 3, "host": "b"},
+		{"ts": 1100, "value": 4, "host": "a"}
+	]`)
+
+	result, stats, err := c.CompressJSONStats(input)
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.Records)
+	require.Equal(t, 3, stats.Groups)
+	require.Equal(t, 3, stats.Rows)
+	require.Equal(t, len(input), stats.BytesIn)
+	require.Equal(t, len(result), stats.BytesOut)
+	require.Equal(t, c.GetCompressionRatio(input, result), stats.Ratio)
+	require.Greater(t, stats.Ratio, 0.0)
+
+	// A pipeline reports the sizes of the whole run
+	c = NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+		Pipeline:          []Stage{{Name: "deadband", Threshold: 0.5}, {Name: "aggregate"}},
+	})
+
+	result, stats, err = c.CompressJSONStats(input)
+	require.NoError(t, err)
+	require.Equal(t, len(input), stats.BytesIn)
+	require.Equal(t, len(result), stats.BytesOut)
+	require.Equal(t, 3, stats.Rows)
+}
@@ -0,0 +1,233 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// StreamingCompressor aggregates records across successive payloads. A window is
+// emitted once the watermark (the latest timestamp seen) is at least one full window
+// past its end, so records arriving slightly out of order still land in their window.
+// The watermark starts at math.MinInt64, as pre-1970 timestamps are valid.
+type StreamingCompressor struct {
+	c *Compressor
+
+	mu        sync.Mutex
+	groups    map[string]*Group
+	watermark int64
+}
+
+// streamSnapshot is the serialized state of a StreamingCompressor
+type streamSnapshot struct {
+	Watermark int64             `json:"watermark"`
+	Groups    map[string]*Group `json:"groups"`
+}
+
+func NewStreamingCompressor(config *Config) *StreamingCompressor {
+	return &StreamingCompressor{
+		c:         NewCompressor(config),
+		groups:    make(map[string]*Group),
+		watermark: math.MinInt64,
+	}
+}
+
+// Add ingests a JSON array and returns the rows of all windows closed by it
+func (s *StreamingCompressor) Add(data []byte) ([]byte, error) {
+	if s.c.err != nil {
+		return nil, s.c.err
+	}
+
+	result := gjson.ParseBytes(data)
+	if !result.IsArray() {
+		return nil, fmt.Errorf("expected JSON array")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make([]map[string]interface{}, 0)
+
+	result.ForEach(
+		func(_, value gjson.Result) bool {
+			if field := s.c.config.SessionEndField; field != "" && value.Get(field).Bool() {
+				// Close the session of the marker's series right away
+				series := s.c.markerSeries(value)
+				rows = append(rows, s.take(func(group *Group) bool {
+					return s.c.groupSeries(group) == series
+				})...)
+				return true
+			}
+
+			s.c.addRecord(s.groups, value)
+			return true
+		},
+	)
+
+	for _, group := range s.groups {
+		if group.LastTime > s.watermark {
+			s.watermark = group.LastTime
+		}
+	}
+
+	rows = append(rows, s.take(func(group *Group) bool {
+		return group.Window+2*group.WindowSize <= s.watermark
+	})...)
+	return json.Marshal(rows)
+}
+
+// Flush returns the rows of all buffered windows and clears them
+func (s *StreamingCompressor) Flush() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.emit(func(*Group) bool { return true })
+}
+
+// Snapshot serializes the buffered windows and watermark so that a new
+// instance can resume the stream with Restore
+func (s *StreamingCompressor) Snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.Marshal(streamSnapshot{Watermark: s.watermark, Groups: s.groups})
+}
+
+// Restore replaces the buffered state with a snapshot taken by Snapshot
+func (s *StreamingCompressor) Restore(data []byte) error {
+	var snap streamSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snap.Groups == nil {
+		snap.Groups = make(map[string]*Group)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = snap.Groups
+	s.watermark = snap.Watermark
+	return nil
+}
+
+// emit removes the groups matching ready and returns their rows ordered by window
+func (s *StreamingCompressor) emit(ready func(*Group) bool) ([]byte, error) {
+	return json.Marshal(s.take(ready))
+}
+
+// take removes the groups matching ready and returns their rows ordered by window
+func (s *StreamingCompressor) take(ready func(*Group) bool) []map[string]interface{} {
+	keys := make([]string, 0)
+	for key, group := range s.groups {
+		if ready(group) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		gi, gj := s.groups[keys[i]], s.groups[keys[j]]
+		if gi.Window != gj.Window {
+			return gi.Window < gj.Window
+		}
+		return keys[i] < keys[j]
+	})
+
+	output := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		if group := s.groups[key]; group.Count >= s.c.config.MinSamples {
+			output = append(output, s.c.buildRow(group))
+		}
+		delete(s.groups, key)
+	}
+
+	return output
+}
+
+// CompressStream compresses newline-delimited JSON records from r and writes each
+// output row to w as a line of JSON. Like StreamingCompressor, a window is written
+// and freed once the latest timestamp read is at least one full window past its end,
+// so memory is bounded by the open windows rather than the input size. The input is
+// assumed to be roughly time-ordered: a record arriving after its window was written
+// starts a new row for that window. Like InputFormat "ndjson", malformed lines are
+// skipped. CollectOverflow does not apply: rejected records are dropped.
+func (c *Compressor) CompressStream(r io.Reader, w io.Writer) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	s := &StreamingCompressor{c: c, groups: make(map[string]*Group), watermark: math.MinInt64}
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	write := func(rows []map[string]interface{}) error {
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	nextCheck := int64(math.MinInt64)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		// Malformed lines are skipped, as with InputFormat "ndjson"
+		if line = bytes.TrimSpace(line); len(line) > 0 && gjson.ValidBytes(line) {
+			record := gjson.ParseBytes(line)
+			c.addRecord(s.groups, record)
+			if ts, ok := c.extractTimestamp(record); ok && ts > s.watermark {
+				s.watermark = ts
+			}
+
+			// Rescan for closed windows only after a window of progress
+			if s.watermark >= nextCheck {
+				rows := s.take(func(group *Group) bool {
+					return group.Window+2*group.WindowSize <= s.watermark
+				})
+				if err := write(rows); err != nil {
+					return err
+				}
+				nextCheck = s.watermark + c.windowUnits()
+			}
+		}
+
+		if readErr == io.EOF {
+			return write(s.take(func(*Group) bool { return true }))
+		}
+	}
+}
+
+// markerSeries returns the series a session end marker belongs to, from its group-by fields
+func (c *Compressor) markerSeries(record gjson.Result) string {
+	tags := make(map[string]string, len(c.config.GroupByFields))
+	for _, field := range c.config.GroupByFields {
+		if val, ok := c.groupByValue(record, field); ok {
+			tags[field] = val
+		}
+	}
+	return tagsKey(tags)
+}
+
+// groupSeries returns the series of a group, from its group-by tags
+func (c *Compressor) groupSeries(group *Group) string {
+	tags := make(map[string]string, len(c.config.GroupByFields))
+	for _, field := range c.config.GroupByFields {
+		if val, ok := group.Tags[field]; ok {
+			tags[field] = val
+		}
+	}
+	return tagsKey(tags)
+}
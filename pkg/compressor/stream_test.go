@@ -0,0 +1,238 @@
+package compressor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func streamTestConfig() *Config {
+	return &Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		GroupByFields:     []string{"host"},
+		CollectFields:     []string{"pod"},
+		AggregationMethod: "sum",
+		TimeWindow:        60 * time.Second,
+	}
+}
+
+var streamTestPayloads = [][]byte{
+	[]byte(`[{"ts": 1000, "value": 1, "host": "a", "pod": "p1"}, {"ts": 1005, "value": 2, "host": "b", "pod": "p2"}]`),
+	[]byte(`[{"ts": 1010, "value": 3, "host": "a", "pod": "p3"}, {"ts": 1030, "value": 4, "host": "a", "pod": "p1"}]`),
+	[]byte(`[{"ts": 1015, "value": 5, "host": "a", "pod": "p4"}, {"ts": 1100, "value": 6, "host": "b"}]`),
+	[]byte(`[{"ts": 1200, "value": 7, "host": "a"}]`),
+}
+
+func collectStreamRows(t *testing.T, chunks ...[]byte) []map[string]interface{} {
+	t.Helper()
+
+	rows := make([]map[string]interface{}, 0)
+	for _, chunk := range chunks {
+		var part []map[string]interface{}
+		require.NoError(t, json.Unmarshal(chunk, &part))
+		rows = append(rows, part...)
+	}
+	return rows
+}
+
+func TestStreamingCompressor_EmitsClosedWindows(t *testing.T) {
+	s := NewStreamingCompressor(streamTestConfig())
+
+	out, err := s.Add(streamTestPayloads[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(out))
+
+	// Watermark 1100 closes the 960 window (960+2*60 <= 1100)
+	out, err = s.Add([]byte(`[{"ts": 1100, "value": 1, "host": "a"}]`))
+	require.NoError(t, err)
+	require.Len(t, collectStreamRows(t, out), 2)
+
+	out, err = s.Flush()
+	require.NoError(t, err)
+	require.Len(t, collectStreamRows(t, out), 1)
+}
+
+func TestStreamingCompressor_NegativeTimestamps(t *testing.T) {
+	s := NewStreamingCompressor(streamTestConfig())
+
+	// Pre-1970 windows stay open until the watermark passes them
+	out, err := s.Add([]byte(`[{"ts": -1000, "value": 1, "host": "a"}, {"ts": -990, "value": 2, "host": "a"}]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(out))
+
+	out, err = s.Add([]byte(`[{"ts": -985, "value": 4, "host": "a"}, {"ts": -800, "value": 8, "host": "a"}]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"ts": -992, "value": 7, "host": "a"}]`, string(out))
+}
+
+func TestStreamingCompressor_SnapshotRestore(t *testing.T) {
+	for _, hash := range []bool{false, true} {
+		config := func() *Config {
+			config := streamTestConfig()
+			config.HashGroupKeys = hash
+			return config
+		}
+
+		// Uninterrupted run
+		full := NewStreamingCompressor(config())
+		fullOut := make([][]byte, 0)
+		for _, payload := range streamTestPayloads {
+			out, err := full.Add(payload)
+			require.NoError(t, err)
+			fullOut = append(fullOut, out)
+		}
+		out, err := full.Flush()
+		require.NoError(t, err)
+		fullOut = append(fullOut, out)
+
+		// Interrupted after the second payload
+		first := NewStreamingCompressor(config())
+		resumedOut := make([][]byte, 0)
+		for _, payload := range streamTestPayloads[:2] {
+			out, err := first.Add(payload)
+			require.NoError(t, err)
+			resumedOut = append(resumedOut, out)
+		}
+
+		snapshot, err := first.Snapshot()
+		require.NoError(t, err)
+
+		second := NewStreamingCompressor(config())
+		require.NoError(t, second.Restore(snapshot))
+
+		for _, payload := range streamTestPayloads[2:] {
+			out, err := second.Add(payload)
+			require.NoError(t, err)
+			resumedOut = append(resumedOut, out)
+		}
+		out, err = second.Flush()
+		require.NoError(t, err)
+		resumedOut = append(resumedOut, out)
+
+		require.Equal(t, collectStreamRows(t, fullOut...), collectStreamRows(t, resumedOut...))
+	}
+}
+
+func TestStreamingCompressor_InvalidInput(t *testing.T) {
+	s := NewStreamingCompressor(nil)
+
+	_, err := s.Add([]byte(`{"not": "array"}`))
+	require.Error(t, err)
+	require.Error(t, s.Restore([]byte(`not json`)))
+}
+
+func TestStreamingCompressor_SessionEnd(t *testing.T) {
+	config := streamTestConfig()
+	config.SessionEndField = "_end"
+	s := NewStreamingCompressor(config)
+
+	out, err := s.Add([]byte(`[{"ts": 1000, "value": 1, "host": "a"}, {"ts": 1005, "value": 2, "host": "b"}]`))
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(out))
+
+	// The marker flushes host a long before the watermark would; host b stays open
+	out, err = s.Add([]byte(`[{"ts": 1010, "value": 3, "host": "a"}, {"_end": true, "host": "a"}, {"ts": 1015, "value": 4, "host": "a"}]`))
+	require.NoError(t, err)
+
+	rows := collectStreamRows(t, out)
+	require.Len(t, rows, 1)
+	require.Equal(t, "a", rows[0]["host"])
+	require.Equal(t, float64(4), rows[0]["value"])
+
+	// Records after the marker start a new session
+	out, err = s.Flush()
+	require.NoError(t, err)
+
+	rows = collectStreamRows(t, out)
+	require.Len(t, rows, 2)
+	for _, row := range rows {
+		switch row["host"] {
+		case "a":
+			require.Equal(t, float64(4), row["value"])
+		case "b":
+			require.Equal(t, float64(2), row["value"])
+		}
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	c := NewCompressor(streamTestConfig())
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := c.CompressStream(inR, outW)
+		outW.CloseWithError(err)
+		done <- err
+	}()
+	out := bufio.NewScanner(outR)
+
+	_, err := io.WriteString(inW, "{\"ts\": 1000, \"value\": 1, \"host\": \"a\"}\n{\"ts\": 1010, \"value\": 2, \"host\": \"a\"}\n\n")
+	require.NoError(t, err)
+	_, err = io.WriteString(inW, "{\"ts\": 1090, \"value\": 4, \"host\": \"a\"}\n{\"ts\": 1140, \"value\": 8, \"host\": \"a\"}\n")
+	require.NoError(t, err)
+
+	// The 960 window is written while the input is still open
+	require.True(t, out.Scan())
+	require.JSONEq(t, `{"ts": 1005, "value": 3, "host": "a"}`, out.Text())
+
+	// The final line needs no trailing newline
+	_, err = io.WriteString(inW, `{"ts": 1150, "value": 16, "host": "a"}`)
+	require.NoError(t, err)
+	require.NoError(t, inW.Close())
+
+	var rows []string
+	for out.Scan() {
+		rows = append(rows, out.Text())
+	}
+	require.NoError(t, <-done)
+	require.Len(t, rows, 2)
+	require.JSONEq(t, `{"ts": 1090, "value": 4, "host": "a"}`, rows[0])
+	require.JSONEq(t, `{"ts": 1145, "value": 24, "host": "a"}`, rows[1])
+}
+
+func TestCompressStream_SkipsInvalidLines(t *testing.T) {
+	c := NewCompressor(streamTestConfig())
+
+	// Like InputFormat "ndjson" in CompressJSON
+	var out strings.Builder
+	require.NoError(t, c.CompressStream(strings.NewReader("{\"ts\": 1000, \"value\": 1}\n{\"ts\": \n{\"ts\": 1010, \"value\": 2}\n"), &out))
+	require.JSONEq(t, `{"ts": 1005, "value": 3}`, out.String())
+
+	config := streamTestConfig()
+	config.InputFormat = "ndjson"
+	result, err := NewCompressor(config).CompressJSON([]byte("{\"ts\": 1000, \"value\": 1}\n{\"ts\": \n{\"ts\": 1010, \"value\": 2}\n"))
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"ts": 1005, "value": 3}]`, string(result))
+}
+
+func TestCompressStream_NegativeTimestamps(t *testing.T) {
+	c := NewCompressor(streamTestConfig())
+
+	var out strings.Builder
+	require.NoError(t, c.CompressStream(strings.NewReader(
+		"{\"ts\": -1000, \"value\": 1}\n{\"ts\": -990, \"value\": 2}\n{\"ts\": -985, \"value\": 4}\n"), &out))
+	require.JSONEq(t, `{"ts": -992, "value": 7}`, out.String())
+}
+
+func TestCompressStream_IgnoresCollectOverflow(t *testing.T) {
+	config := streamTestConfig()
+	config.CollectOverflow = true
+	c := NewCompressor(config)
+
+	var out strings.Builder
+	require.NoError(t, c.CompressStream(strings.NewReader(
+		"{\"value\": 1, \"host\": \"a\"}\n"+
+			"{\"ts\": 1000, \"value\": 1, \"host\": \"a\"}\n"+
+			"{\"value\": 1, \"host\": \"a\"}\n"+
+			"{\"ts\": 1200, \"value\": 1, \"host\": \"a\"}\n"), &out))
+	require.NotContains(t, out.String(), "_overflow")
+	require.Equal(t, 2, strings.Count(out.String(), "\n"))
+}
@@ -0,0 +1,95 @@
+package compressor
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxEscalatedWindow is the widest window CompressJSONUnderSize will try
+const maxEscalatedWindow = 30 * 24 * time.Hour
+
+// CompressJSONUnderSize compresses data, doubling the window until the output fits in
+// maxBytes. It returns the payload and the window that produced it, or an error if the
+// output still exceeds maxBytes at the widest window.
+func (c *Compressor) CompressJSONUnderSize(data []byte, maxBytes int) ([]byte, time.Duration, error) {
+	window := c.config.TimeWindow
+
+	for {
+		compressed, err := c.withWindow(window).CompressJSON(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(compressed) <= maxBytes {
+			return compressed, window, nil
+		}
+
+		if window >= maxEscalatedWindow {
+			return nil, 0, fmt.Errorf("output of %d bytes exceeds %d bytes even with a %s window", len(compressed), maxBytes, window)
+		}
+		window = min(window*2, maxEscalatedWindow)
+	}
+}
+
+// SuggestWindow estimates the window that compresses data into roughly targetRecords rows.
+// It runs two trial compressions and interpolates between them assuming the number of
+// output rows follows a power law of the window size.
+func (c *Compressor) SuggestWindow(data []byte, targetRecords int) (time.Duration, error) {
+	if targetRecords <= 0 {
+		return 0, fmt.Errorf("target records must be positive, got %d", targetRecords)
+	}
+
+	w1 := c.config.TimeWindow
+	r1, err := c.countRows(data, w1)
+	if err != nil {
+		return 0, err
+	}
+	if r1 == 0 {
+		return 0, fmt.Errorf("no records to compress")
+	}
+
+	// First guess: output rows inversely proportional to the window
+	w2 := clampWindow(time.Duration(float64(w1) * float64(r1) / float64(targetRecords)))
+	if w2 == w1 {
+		w2 = w1 * 2
+	}
+	r2, err := c.countRows(data, w2)
+	if err != nil {
+		return 0, err
+	}
+
+	// rows ~ a * window^k, solve for the window giving targetRecords
+	k := math.Log(float64(r2)/float64(r1)) / math.Log(float64(w2)/float64(w1))
+	if k == 0 || math.IsNaN(k) || math.IsInf(k, 0) {
+		// Row count does not depend on the window (e.g. a single window already)
+		return w2, nil
+	}
+
+	suggested := float64(w1) * math.Pow(float64(targetRecords)/float64(r1), 1/k)
+	return clampWindow(time.Duration(suggested)), nil
+}
+
+// countRows returns the number of output rows data compresses into with the given window
+func (c *Compressor) countRows(data []byte, window time.Duration) (int, error) {
+	groups, err := c.withWindow(window).collectGroups(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(groups), nil
+}
+
+// withWindow returns a copy of the compressor using a different window size
+func (c *Compressor) withWindow(window time.Duration) *Compressor {
+	trial := &Compressor{config: c.config}
+	trial.config.TimeWindow = window
+	return trial
+}
+
+// clampWindow rounds a window to whole seconds, never below one second
+func clampWindow(window time.Duration) time.Duration {
+	window = window.Round(time.Second)
+	if window < time.Second {
+		return time.Second
+	}
+	return window
+}
@@ -0,0 +1,80 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestWindow(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "avg",
+		TimeWindow:        10 * time.Second,
+	})
+
+	// One point per second for an hour
+	points := make([]map[string]interface{}, 0, 3600)
+	for i := 0; i < 3600; i++ {
+		points = append(points, map[string]interface{}{"ts": 1_700_000_000 + i, "value": i % 7})
+	}
+	data, err := json.Marshal(points)
+	require.NoError(t, err)
+
+	for _, target := range []int{60, 10, 500} {
+		window, err := c.SuggestWindow(data, target)
+		require.NoError(t, err)
+
+		rows, err := c.countRows(data, window)
+		require.NoError(t, err)
+		require.InDelta(t, target, rows, float64(target)*0.2, "window %s gave %d rows for target %d", window, rows, target)
+	}
+}
+
+func TestSuggestWindow_InvalidInput(t *testing.T) {
+	c := NewCompressor(nil)
+
+	_, err := c.SuggestWindow([]byte(`[{"timestamp": 1000, "value": 1}]`), 0)
+	require.Error(t, err)
+
+	_, err = c.SuggestWindow([]byte(`[]`), 10)
+	require.Error(t, err)
+
+	_, err = c.SuggestWindow([]byte(`{}`), 10)
+	require.Error(t, err)
+}
+
+func TestCompressJSONUnderSize(t *testing.T) {
+	c := NewCompressor(&Config{
+		TimestampField:    "ts",
+		ValueFields:       []string{"value"},
+		AggregationMethod: "sum",
+		TimeWindow:        time.Minute,
+	})
+
+	// One point every 10s for a day
+	points := make([]map[string]interface{}, 0, 8640)
+	for i := 0; i < 8640; i++ {
+		points = append(points, map[string]interface{}{"ts": 1_700_000_000 + i*10, "value": 1})
+	}
+	data, err := json.Marshal(points)
+	require.NoError(t, err)
+
+	plain, err := c.CompressJSON(data)
+	require.NoError(t, err)
+
+	limit := 4096
+	require.Greater(t, len(plain), limit)
+
+	compressed, window, err := c.CompressJSONUnderSize(data, limit)
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(compressed), limit)
+	require.Greater(t, window, time.Minute)
+
+	// Nothing fits into a handful of bytes
+	_, _, err = c.CompressJSONUnderSize(data, 5)
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package compressor
+
+import "encoding/json"
+
+// summaryStats are the statistics CompressSummary emits for every value field
+var summaryStats = []string{"min", "max", "avg", "sum", "count"}
+
+// CompressSummary aggregates data with the windowing and grouping of CompressJSON but,
+// instead of applying the configured method, emits "<field>_min", "<field>_max",
+// "<field>_avg", "<field>_sum" and "<field>_count" for every value field present in a
+// row. Rows keep their timestamp, tags, collected and passthrough fields.
+func (c *Compressor) CompressSummary(data []byte) ([]byte, error) {
+	groups, err := c.collectGroups(data)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]map[string]interface{}, 0, len(groups))
+	for _, group := range c.orderedGroups(groups) {
+		row := map[string]interface{}{
+			c.config.TimestampField: c.formatTimestamp(c.rowTimestamp(group)),
+		}
+		for k, v := range group.Tags {
+			row[k] = v
+		}
+		for field, collected := range group.Collected {
+			row[field] = collected
+		}
+		for field, value := range group.Passthrough {
+			row[field] = value
+		}
+
+		if len(c.config.ValueFields) == 0 {
+			// Count-only mode has no values to summarize
+			row["count"] = group.Count
+		}
+		for _, field := range c.config.ValueFields {
+			f, ok := group.Fields[field]
+			if !ok {
+				continue
+			}
+
+			summary := f.Running
+			if summary == nil {
+				summary = &RunningAggregate{}
+				for _, v := range f.Values {
+					summary.add(v, 1)
+				}
+			}
+
+			prefix := c.outputField(field) + "_"
+			for _, stat := range summaryStats {
+				row[prefix+stat] = summary.result(stat)
+			}
+		}
+
+		output = append(output, row)
+	}
+
+	return json.Marshal(output)
+}
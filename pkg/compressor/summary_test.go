@@ -0,0 +1,51 @@
+package compressor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressSummary(t *testing.T) {
+	input := []byte(`[
+		{"ts": 1000, "cpu": 40, "mem": 10, "host": "web1"},
+		{"ts": 1010, "cpu": 90, "host": "web1"},
+		{"ts": 1015, "cpu": 20, "mem": 30, "host": "web1"},
+		{"ts": 1100, "cpu": 5, "host": "web2"}
+	]`)
+
+	// Running-aggregate and value-keeping methods summarize alike
+	for _, method := range []string{"sum", "median"} {
+		c := NewCompressor(&Config{
+			TimestampField:    "ts",
+			ValueFields:       []string{"cpu", "mem"},
+			GroupByFields:     []string{"host"},
+			AggregationMethod: method,
+			TimeWindow:        60 * time.Second,
+		})
+
+		result, err := c.CompressSummary(input)
+		require.NoError(t, err)
+
+		var output []map[string]interface{}
+		require.NoError(t, json.Unmarshal(result, &output))
+		require.Len(t, output, 2, method)
+
+		require.Equal(t, map[string]interface{}{
+			"ts": float64(1007), "host": "web1",
+			"cpu_min": float64(20), "cpu_max": float64(90), "cpu_avg": float64(50), "cpu_sum": float64(150), "cpu_count": float64(3),
+			"mem_min": float64(10), "mem_max": float64(30), "mem_avg": float64(20), "mem_sum": float64(40), "mem_count": float64(2),
+		}, output[0], method)
+
+		// web2 has no mem values
+		require.Equal(t, map[string]interface{}{
+			"ts": float64(1100), "host": "web2",
+			"cpu_min": float64(5), "cpu_max": float64(5), "cpu_avg": float64(5), "cpu_sum": float64(5), "cpu_count": float64(1),
+		}, output[1], method)
+	}
+
+	_, err := NewCompressor(nil).CompressSummary([]byte(`{}`))
+	require.Error(t, err)
+}